@@ -0,0 +1,92 @@
+package api
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	http "github.com/bogdanfinn/fhttp"
+)
+
+const (
+	accountsSweepInterval = time.Hour
+
+	UnverifiedAccountErrorMessage = "Failed to verify the account of the access token."
+)
+
+// the JWT is not verified locally, so the account of an access token is only trusted after the upstream accepts the token,
+// which lets the data kept by the proxy (e.g. the archive) follow the account instead of each renewed access token
+var (
+	verifiedAccounts      = make(map[string]verifiedAccount)
+	verifiedAccountsMutex sync.Mutex
+	lastAccountsSweepTime = time.Now()
+)
+
+type verifiedAccount struct {
+	userID  string
+	expires time.Time
+}
+
+// VerifyAccount returns the user ID of the ChatGPT access token, the token is checked with the upstream once until it expires
+//
+//goland:noinspection GoUnhandledErrorResult
+func VerifyAccount(accessToken string) (string, error) {
+	key := HashKey(accessToken)
+	now := time.Now()
+
+	verifiedAccountsMutex.Lock()
+	sweepVerifiedAccounts(now)
+	account, ok := verifiedAccounts[key]
+	verifiedAccountsMutex.Unlock()
+	if ok && now.Before(account.expires) {
+		return account.userID, nil
+	}
+
+	claims, err := ParseAccessToken(accessToken)
+	if err != nil {
+		return "", err
+	}
+
+	if claims.UserID == "" || claims.Expired {
+		return "", errors.New(UnverifiedAccountErrorMessage)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, ChatGPTApiUrlPrefix+"/backend-api/me", nil)
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set(AuthorizationHeader, GetAccessToken(accessToken))
+	resp, err := Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New(UnverifiedAccountErrorMessage)
+	}
+
+	expires := claims.ExpiresAt
+	if expires.Unix() == 0 {
+		expires = now.Add(accountsSweepInterval)
+	}
+
+	verifiedAccountsMutex.Lock()
+	verifiedAccounts[key] = verifiedAccount{
+		userID:  claims.UserID,
+		expires: expires,
+	}
+	verifiedAccountsMutex.Unlock()
+	return claims.UserID, nil
+}
+
+func sweepVerifiedAccounts(now time.Time) {
+	if now.Sub(lastAccountsSweepTime) < accountsSweepInterval {
+		return
+	}
+
+	for key, account := range verifiedAccounts {
+		if !now.Before(account.expires) {
+			delete(verifiedAccounts, key)
+		}
+	}
+	lastAccountsSweepTime = now
+}
@@ -0,0 +1,125 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/linweiyuan/go-chatgpt-api/api"
+
+	http "github.com/bogdanfinn/fhttp"
+)
+
+func NewMessageID() string {
+	return messageIDPrefix + strings.ReplaceAll(api.NewUUID(), "-", "")
+}
+
+// ConvertFinishReason maps the OpenAI finish reason (and the ChatGPT finish type) to the stop reason
+func ConvertFinishReason(finishReason string) string {
+	if finishReason == "length" || finishReason == "max_tokens" {
+		return StopReasonMaxTokens
+	}
+
+	return StopReasonEndTurn
+}
+
+func NewMessagesResponse(id string, model string, text string, stopReason string, usage Usage) MessagesResponse {
+	return MessagesResponse{
+		ID:    id,
+		Type:  messageType,
+		Role:  roleAssistant,
+		Model: model,
+		Content: []ContentBlock{{
+			Type: contentBlockTypeText,
+			Text: text,
+		}},
+		StopReason: &stopReason,
+		Usage:      usage,
+	}
+}
+
+// NewErrorResponse maps the status code of the upstream to the error type of the Anthropic API
+func NewErrorResponse(statusCode int, message string) ErrorResponse {
+	errorDetailType := errorTypeApi
+	switch statusCode {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		errorDetailType = errorTypeInvalidRequest
+	case http.StatusUnauthorized:
+		errorDetailType = errorTypeAuthentication
+	case http.StatusForbidden:
+		errorDetailType = errorTypePermission
+	case http.StatusNotFound:
+		errorDetailType = errorTypeNotFound
+	case http.StatusRequestEntityTooLarge:
+		errorDetailType = errorTypeRequestTooLarge
+	case http.StatusTooManyRequests:
+		errorDetailType = errorTypeRateLimit
+	case http.StatusServiceUnavailable:
+		errorDetailType = errorTypeOverloaded
+	}
+
+	return ErrorResponse{
+		Type: errorType,
+		Error: ErrorDetail{
+			Type:    errorDetailType,
+			Message: message,
+		},
+	}
+}
+
+// WriteMessageStart sends message_start and content_block_start, only one text block is used
+func WriteMessageStart(c *gin.Context, id string, model string) {
+	c.Writer.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+
+	writeEvent(c, eventMessageStart, MessageStartEvent{
+		Type: eventMessageStart,
+		Message: MessagesResponse{
+			ID:      id,
+			Type:    messageType,
+			Role:    roleAssistant,
+			Model:   model,
+			Content: []ContentBlock{},
+		},
+	})
+	writeEvent(c, eventContentBlockStart, ContentBlockStartEvent{
+		Type: eventContentBlockStart,
+		ContentBlock: ContentBlock{
+			Type: contentBlockTypeText,
+		},
+	})
+}
+
+func WriteTextDelta(c *gin.Context, text string) {
+	writeEvent(c, eventContentBlockDelta, ContentBlockDeltaEvent{
+		Type: eventContentBlockDelta,
+		Delta: TextDelta{
+			Type: textDeltaType,
+			Text: text,
+		},
+	})
+}
+
+// WriteMessageStop sends content_block_stop, message_delta and message_stop
+func WriteMessageStop(c *gin.Context, stopReason string, usage Usage) {
+	writeEvent(c, eventContentBlockStop, ContentBlockStopEvent{
+		Type: eventContentBlockStop,
+	})
+
+	messageDeltaEvent := MessageDeltaEvent{
+		Type:  eventMessageDelta,
+		Usage: usage,
+	}
+	messageDeltaEvent.Delta.StopReason = stopReason
+	writeEvent(c, eventMessageDelta, messageDeltaEvent)
+
+	writeEvent(c, eventMessageStop, MessageStopEvent{
+		Type: eventMessageStop,
+	})
+}
+
+//goland:noinspection GoUnhandledErrorResult
+func writeEvent(c *gin.Context, event string, data interface{}) {
+	jsonBytes, _ := json.Marshal(data)
+	c.Writer.Write([]byte("event: " + event + "\ndata: " + string(jsonBytes) + "\n\n"))
+	c.Writer.Flush()
+}
@@ -0,0 +1,38 @@
+package anthropic
+
+const (
+	messageIDPrefix      = "msg_"
+	messageType          = "message"
+	roleAssistant        = "assistant"
+	contentBlockTypeText = "text"
+	textDeltaType        = "text_delta"
+
+	eventMessageStart      = "message_start"
+	eventContentBlockStart = "content_block_start"
+	eventContentBlockDelta = "content_block_delta"
+	eventContentBlockStop  = "content_block_stop"
+	eventMessageDelta      = "message_delta"
+	eventMessageStop       = "message_stop"
+
+	errorType                = "error"
+	errorTypeInvalidRequest  = "invalid_request_error"
+	errorTypeAuthentication  = "authentication_error"
+	errorTypePermission      = "permission_error"
+	errorTypeNotFound        = "not_found_error"
+	errorTypeRequestTooLarge = "request_too_large"
+	errorTypeRateLimit       = "rate_limit_error"
+	errorTypeOverloaded      = "overloaded_error"
+	errorTypeApi             = "api_error"
+
+	StopReasonEndTurn   = "end_turn"
+	StopReasonMaxTokens = "max_tokens"
+
+	ApiKeyHeader = "x-api-key"
+
+	claudeModelPrefix = "claude-"
+	claude2Model      = "claude-2"
+	claudeOpus        = "opus"
+	claudeSonnet      = "sonnet"
+	gpt4Model         = "gpt-4"
+	gpt35TurboModel   = "gpt-3.5-turbo"
+)
@@ -0,0 +1,37 @@
+package anthropic
+
+import (
+	"os"
+	"strings"
+)
+
+// the Claude models are served by the OpenAI ones, the larger ones by GPT-4 and the smaller ones by GPT-3.5,
+// GO_CHATGPT_API_ANTHROPIC_MODEL_MAP overrides it with "claude-model=openai-model" pairs, other names are passed through
+var modelMap = make(map[string]string)
+
+//goland:noinspection SpellCheckingInspection
+func init() {
+	for _, pair := range strings.Split(os.Getenv("GO_CHATGPT_API_ANTHROPIC_MODEL_MAP"), ",") {
+		claudeModel, openAIModel, found := strings.Cut(pair, "=")
+		if found && strings.TrimSpace(claudeModel) != "" && strings.TrimSpace(openAIModel) != "" {
+			modelMap[strings.TrimSpace(claudeModel)] = strings.TrimSpace(openAIModel)
+		}
+	}
+}
+
+// ConvertModel maps the Claude model of the request to the OpenAI model
+func ConvertModel(model string) string {
+	if openAIModel, ok := modelMap[model]; ok {
+		return openAIModel
+	}
+
+	if !strings.HasPrefix(model, claudeModelPrefix) {
+		return model
+	}
+
+	if strings.Contains(model, claudeOpus) || strings.Contains(model, claudeSonnet) || strings.HasPrefix(model, claude2Model) {
+		return gpt4Model
+	}
+
+	return gpt35TurboModel
+}
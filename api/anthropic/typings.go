@@ -0,0 +1,123 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+type MessagesRequest struct {
+	Model         string            `json:"model"`
+	System        json.RawMessage   `json:"system,omitempty"` // string or text blocks
+	Messages      []MessagesMessage `json:"messages"`
+	MaxTokens     int               `json:"max_tokens"`
+	Stream        bool              `json:"stream,omitempty"`
+	Temperature   float64           `json:"temperature,omitempty"`
+	TopP          float64           `json:"top_p,omitempty"`
+	StopSequences []string          `json:"stop_sequences,omitempty"`
+}
+
+type MessagesMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"` // string or content blocks
+}
+
+type ContentBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type MessagesResponse struct {
+	ID           string         `json:"id"`
+	Type         string         `json:"type"`
+	Role         string         `json:"role"`
+	Model        string         `json:"model"`
+	Content      []ContentBlock `json:"content"`
+	StopReason   *string        `json:"stop_reason"`
+	StopSequence *string        `json:"stop_sequence"`
+	Usage        Usage          `json:"usage"`
+}
+
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type ErrorResponse struct {
+	Type  string      `json:"type"`
+	Error ErrorDetail `json:"error"`
+}
+
+type ErrorDetail struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+type MessageStartEvent struct {
+	Type    string           `json:"type"`
+	Message MessagesResponse `json:"message"`
+}
+
+type ContentBlockStartEvent struct {
+	Type         string       `json:"type"`
+	Index        int          `json:"index"`
+	ContentBlock ContentBlock `json:"content_block"`
+}
+
+type ContentBlockDeltaEvent struct {
+	Type  string    `json:"type"`
+	Index int       `json:"index"`
+	Delta TextDelta `json:"delta"`
+}
+
+type TextDelta struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type ContentBlockStopEvent struct {
+	Type  string `json:"type"`
+	Index int    `json:"index"`
+}
+
+type MessageDeltaEvent struct {
+	Type  string `json:"type"`
+	Delta struct {
+		StopReason   string  `json:"stop_reason"`
+		StopSequence *string `json:"stop_sequence"`
+	} `json:"delta"`
+	Usage Usage `json:"usage"`
+}
+
+type MessageStopEvent struct {
+	Type string `json:"type"`
+}
+
+func (request MessagesRequest) SystemText() string {
+	return contentText(request.System)
+}
+
+func (message MessagesMessage) Text() string {
+	return contentText(message.Content)
+}
+
+// contentText accepts both the string form and the content blocks form, non text blocks are ignored
+func contentText(content json.RawMessage) string {
+	if len(content) == 0 {
+		return ""
+	}
+
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return text
+	}
+
+	var blocks []ContentBlock
+	json.Unmarshal(content, &blocks)
+	texts := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		if block.Type == contentBlockTypeText {
+			texts = append(texts, block.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
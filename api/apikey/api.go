@@ -0,0 +1,110 @@
+package apikey
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/linweiyuan/go-chatgpt-api/api"
+
+	http "github.com/bogdanfinn/fhttp"
+)
+
+// CreateProxyKey issues a new proxy key for the upstream credentials, the key is only returned here
+func CreateProxyKey(c *gin.Context) {
+	if !checkEnabled(c) {
+		return
+	}
+
+	var request CreateProxyKeyRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, api.ReturnMessage(parseRequestErrorMessage))
+		return
+	}
+
+	request.ChatGPTAccessTokens = trimCredentials(request.ChatGPTAccessTokens)
+	request.PlatformApiKeys = trimCredentials(request.PlatformApiKeys)
+	if len(request.ChatGPTAccessTokens) == 0 && len(request.PlatformApiKeys) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, api.ReturnMessage(emptyCredentialsErrorMessage))
+		return
+	}
+
+	proxyKey, key, err := createProxyKey(request)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(saveProxyKeyErrorMessage))
+		return
+	}
+
+	response := newProxyKeyResponse(proxyKey)
+	response.Key = key
+	c.JSON(http.StatusOK, response)
+}
+
+func ListProxyKeys(c *gin.Context) {
+	if !checkEnabled(c) {
+		return
+	}
+
+	proxyKeys := getProxyKeys()
+	items := make([]ProxyKeyResponse, 0, len(proxyKeys))
+	for _, proxyKey := range proxyKeys {
+		items = append(items, newProxyKeyResponse(proxyKey))
+	}
+
+	c.JSON(http.StatusOK, ListProxyKeysResponse{
+		Items: items,
+		Total: len(items),
+	})
+}
+
+func RevokeProxyKey(c *gin.Context) {
+	if !checkEnabled(c) {
+		return
+	}
+
+	proxyKey, err := revokeProxyKey(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(saveProxyKeyErrorMessage))
+		return
+	}
+
+	if proxyKey == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, api.ReturnMessage(proxyKeyNotFoundErrorMessage))
+		return
+	}
+
+	c.JSON(http.StatusOK, newProxyKeyResponse(proxyKey))
+}
+
+func checkEnabled(c *gin.Context) bool {
+	if !Enabled() {
+		c.AbortWithStatusJSON(http.StatusNotFound, api.ReturnMessage(keyStoreDisabledErrorMessage))
+		return false
+	}
+
+	return true
+}
+
+func trimCredentials(credentials []string) []string {
+	var trimmed []string
+	for _, credential := range credentials {
+		credential = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(credential), "Bearer "))
+		if credential != "" {
+			trimmed = append(trimmed, credential)
+		}
+	}
+
+	return trimmed
+}
+
+func newProxyKeyResponse(proxyKey *ProxyKey) ProxyKeyResponse {
+	return ProxyKeyResponse{
+		ID:                      proxyKey.ID,
+		Name:                    proxyKey.Name,
+		KeyHint:                 proxyKey.KeyHint,
+		ChatGPTAccessTokenCount: len(proxyKey.ChatGPTAccessTokens),
+		PlatformApiKeyCount:     len(proxyKey.PlatformApiKeys),
+		Limits:                  proxyKey.Limits,
+		CreateTime:              proxyKey.CreateTime,
+		RevokeTime:              proxyKey.RevokeTime,
+	}
+}
@@ -0,0 +1,23 @@
+package apikey
+
+const (
+	keysBucket = "keys"
+
+	// ProxyKeyPrefix tells the proxy keys apart from the upstream credentials
+	ProxyKeyPrefix = "pk-"
+	proxyKeyLength = 24
+	keyHintLength  = 8
+
+	// ContextKey holds the proxy key of the request in the gin context
+	ContextKey = "proxyKey"
+
+	parseRequestErrorMessage     = "Failed to parse proxy key request."
+	keyStoreDisabledErrorMessage = "Key store is not enabled, set GO_CHATGPT_API_KEY_STORE to enable it."
+	emptyCredentialsErrorMessage = "At least one ChatGPT access token or platform API key is required."
+	saveProxyKeyErrorMessage     = "Failed to save proxy key."
+	proxyKeyNotFoundErrorMessage = "Proxy key is not found."
+	InvalidProxyKeyErrorMessage  = "Invalid or revoked proxy key."
+	NoChatGPTAccessTokenMessage  = "No ChatGPT access token is mapped to the proxy key."
+	NoPlatformApiKeyMessage      = "No platform API key is mapped to the proxy key."
+	ProxyKeyRequiredErrorMessage = "A proxy key is required."
+)
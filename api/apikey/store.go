@@ -0,0 +1,189 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/linweiyuan/go-chatgpt-api/api"
+	"github.com/linweiyuan/go-chatgpt-api/util/logger"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	db *bolt.DB
+
+	// all proxy keys are kept in memory by the key hash, the store is only read at startup
+	proxyKeys = make(map[string]*ProxyKey)
+	// index of the next platform API key of each proxy key
+	nextPlatformApiKey = make(map[string]int)
+	mutex              sync.RWMutex
+)
+
+//goland:noinspection SpellCheckingInspection
+func init() {
+	path := os.Getenv("GO_CHATGPT_API_KEY_STORE")
+	if path == "" {
+		return
+	}
+
+	var err error
+	db, err = bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		logger.Error("Failed to open key store: " + err.Error())
+		os.Exit(1)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(keysBucket))
+		if err != nil {
+			return err
+		}
+
+		return bucket.ForEach(func(_, data []byte) error {
+			var proxyKey ProxyKey
+			if err := json.Unmarshal(data, &proxyKey); err != nil {
+				return err
+			}
+
+			load(&proxyKey)
+			return nil
+		})
+	})
+	if err != nil {
+		logger.Error("Failed to init key store: " + err.Error())
+		os.Exit(1)
+	}
+
+	logger.Info("GO_CHATGPT_API_KEY_STORE: " + path + ", " + strconv.Itoa(len(proxyKeys)) + " proxy keys")
+}
+
+func Enabled() bool {
+	return db != nil
+}
+
+// Lookup returns the proxy key if it is issued and not revoked
+func Lookup(key string) (*ProxyKey, bool) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	proxyKey, ok := proxyKeys[api.HashKey(key)]
+	if !ok || proxyKey.RevokeTime != nil {
+		return nil, false
+	}
+
+	return proxyKey, true
+}
+
+// NextPlatformApiKey rotates the platform API keys of the proxy key
+func NextPlatformApiKey(proxyKey *ProxyKey) (string, bool) {
+	if len(proxyKey.PlatformApiKeys) == 0 {
+		return "", false
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	index := nextPlatformApiKey[proxyKey.KeyHash] % len(proxyKey.PlatformApiKeys)
+	nextPlatformApiKey[proxyKey.KeyHash] = index + 1
+	return proxyKey.PlatformApiKeys[index], true
+}
+
+// load indexes the proxy key, its ChatGPT access tokens become a token pool of the key
+func load(proxyKey *ProxyKey) {
+	proxyKeys[proxyKey.KeyHash] = proxyKey
+	if proxyKey.RevokeTime == nil && len(proxyKey.ChatGPTAccessTokens) != 0 {
+		api.RegisterTokenPool(proxyKey.KeyHash, proxyKey.ChatGPTAccessTokens, proxyKey.Strategy)
+	}
+}
+
+func createProxyKey(request CreateProxyKeyRequest) (*ProxyKey, string, error) {
+	random := make([]byte, proxyKeyLength)
+	if _, err := rand.Read(random); err != nil {
+		return nil, "", err
+	}
+
+	key := ProxyKeyPrefix + hex.EncodeToString(random)
+	proxyKey := &ProxyKey{
+		ID:                  api.NewUUID(),
+		Name:                request.Name,
+		KeyHash:             api.HashKey(key),
+		KeyHint:             key[:len(ProxyKeyPrefix)+keyHintLength] + "...",
+		ChatGPTAccessTokens: request.ChatGPTAccessTokens,
+		PlatformApiKeys:     request.PlatformApiKeys,
+		Strategy:            request.Strategy,
+		Limits:              request.Limits,
+		CreateTime:          time.Now(),
+	}
+	if err := save(proxyKey); err != nil {
+		return nil, "", err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	load(proxyKey)
+	return proxyKey, key, nil
+}
+
+// revokeProxyKey keeps the revoked key in the store so that it is still listed
+func revokeProxyKey(id string) (*ProxyKey, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	for _, proxyKey := range proxyKeys {
+		if proxyKey.ID != id {
+			continue
+		}
+
+		if proxyKey.RevokeTime != nil {
+			return proxyKey, nil
+		}
+
+		revoked := *proxyKey
+		now := time.Now()
+		revoked.RevokeTime = &now
+		if err := save(&revoked); err != nil {
+			return nil, err
+		}
+
+		proxyKeys[proxyKey.KeyHash] = &revoked
+		delete(nextPlatformApiKey, proxyKey.KeyHash)
+		api.UnregisterTokenPool(proxyKey.KeyHash)
+		return &revoked, nil
+	}
+
+	return nil, nil
+}
+
+// getProxyKeys returns all proxy keys, the latest created first
+func getProxyKeys() []*ProxyKey {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	list := make([]*ProxyKey, 0, len(proxyKeys))
+	for _, proxyKey := range proxyKeys {
+		list = append(list, proxyKey)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreateTime.After(list[j].CreateTime)
+	})
+	return list
+}
+
+func save(proxyKey *ProxyKey) error {
+	data, err := json.Marshal(proxyKey)
+	if err != nil {
+		return err
+	}
+
+	return db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(keysBucket)).Put([]byte(proxyKey.ID), data)
+	})
+}
@@ -0,0 +1,47 @@
+package apikey
+
+import (
+	"time"
+
+	"github.com/linweiyuan/go-chatgpt-api/api/limiter"
+)
+
+// ProxyKey is stored by the hash of the key, the key itself is only returned once when created
+type ProxyKey struct {
+	ID                  string          `json:"id"`
+	Name                string          `json:"name"`
+	KeyHash             string          `json:"key_hash"`
+	KeyHint             string          `json:"key_hint"`
+	ChatGPTAccessTokens []string        `json:"chatgpt_access_tokens"`
+	PlatformApiKeys     []string        `json:"platform_api_keys"`
+	Strategy            string          `json:"strategy"`
+	Limits              *limiter.Limits `json:"limits"`
+	CreateTime          time.Time       `json:"create_time"`
+	RevokeTime          *time.Time      `json:"revoke_time"`
+}
+
+type CreateProxyKeyRequest struct {
+	Name                string          `json:"name"`
+	ChatGPTAccessTokens []string        `json:"chatgpt_access_tokens"`
+	PlatformApiKeys     []string        `json:"platform_api_keys"`
+	Strategy            string          `json:"strategy"`
+	Limits              *limiter.Limits `json:"limits"`
+}
+
+// ProxyKeyResponse never contains the upstream credentials, Key is only set when created
+type ProxyKeyResponse struct {
+	ID                      string          `json:"id"`
+	Name                    string          `json:"name"`
+	Key                     string          `json:"key,omitempty"`
+	KeyHint                 string          `json:"key_hint"`
+	ChatGPTAccessTokenCount int             `json:"chatgpt_access_token_count"`
+	PlatformApiKeyCount     int             `json:"platform_api_key_count"`
+	Limits                  *limiter.Limits `json:"limits"`
+	CreateTime              time.Time       `json:"create_time"`
+	RevokeTime              *time.Time      `json:"revoke_time"`
+}
+
+type ListProxyKeysResponse struct {
+	Items []ProxyKeyResponse `json:"items"`
+	Total int                `json:"total"`
+}
@@ -0,0 +1,154 @@
+package archive
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/linweiyuan/go-chatgpt-api/api"
+	"github.com/linweiyuan/go-chatgpt-api/api/limiter"
+
+	http "github.com/bogdanfinn/fhttp"
+)
+
+func ListConversations(c *gin.Context) {
+	if !checkEnabled(c) {
+		return
+	}
+
+	offset, limit := pagination(c)
+	conversations, err := getConversations(Owner(c))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(getConversationsErrorMessage))
+		return
+	}
+
+	items := make([]ConversationItem, 0, limit)
+	for i := offset; i < len(conversations) && i < offset+limit; i++ {
+		conversation := conversations[i]
+		items = append(items, ConversationItem{
+			ID:           conversation.ID,
+			Title:        conversation.Title,
+			CreateTime:   conversation.CreateTime,
+			UpdateTime:   conversation.UpdateTime,
+			MessageCount: len(conversation.Messages),
+		})
+	}
+
+	c.JSON(http.StatusOK, ListConversationsResponse{
+		Items:  items,
+		Total:  len(conversations),
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+func GetConversation(c *gin.Context) {
+	if !checkEnabled(c) {
+		return
+	}
+
+	conversation, err := getConversation(Owner(c), c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(getConversationsErrorMessage))
+		return
+	}
+
+	if conversation == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, api.ReturnMessage(conversationNotFoundErrorMessage))
+		return
+	}
+
+	c.JSON(http.StatusOK, conversation)
+}
+
+// SearchConversations matches the prompts and the responses case-insensitively, the latest updated first
+func SearchConversations(c *gin.Context) {
+	if !checkEnabled(c) {
+		return
+	}
+
+	query := strings.ToLower(strings.TrimSpace(c.Query("q")))
+	if query == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, api.ReturnMessage(emptyQueryErrorMessage))
+		return
+	}
+
+	offset, limit := pagination(c)
+	conversations, err := getConversations(Owner(c))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(getConversationsErrorMessage))
+		return
+	}
+
+	items := make([]SearchResult, 0, limit)
+	total := 0
+	for _, conversation := range conversations {
+		for _, message := range conversation.Messages {
+			if !strings.Contains(strings.ToLower(message.Prompt), query) &&
+				!strings.Contains(strings.ToLower(message.Response), query) {
+				continue
+			}
+
+			if total >= offset && total < offset+limit {
+				items = append(items, SearchResult{
+					ConversationID: conversation.ID,
+					Title:          conversation.Title,
+					Message:        message,
+				})
+			}
+			total++
+		}
+	}
+
+	c.JSON(http.StatusOK, SearchConversationsResponse{
+		Items: items,
+		Total: total,
+	})
+}
+
+// Owner returns the owner of the archived conversations of the caller, which is the identity of the rate limiter
+// (the proxy key, the managed session or the pool key), a raw access token is followed by its account instead,
+// so the conversations survive the renewed tokens, the token itself is the owner only if the account can not be verified
+func Owner(c *gin.Context) string {
+	identity := c.GetString(limiter.ContextKey)
+	if !strings.HasPrefix(identity, tokenIdentityPrefix) {
+		return identity
+	}
+
+	userID, err := api.VerifyAccount(c.GetHeader(api.AuthorizationHeader))
+	if err != nil {
+		return identity
+	}
+
+	return accountOwnerPrefix + api.HashKey(userID)
+}
+
+// checkEnabled also makes sure the caller is identified, which is the owner of the conversations
+func checkEnabled(c *gin.Context) bool {
+	if !Enabled() {
+		c.AbortWithStatusJSON(http.StatusNotFound, api.ReturnMessage(archiveDisabledErrorMessage))
+		return false
+	}
+
+	if c.GetString(limiter.ContextKey) == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, api.ReturnMessage(unknownOwnerErrorMessage))
+		return false
+	}
+
+	return true
+}
+
+func pagination(c *gin.Context) (int, int) {
+	offset, err := strconv.Atoi(c.Query("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultLimit
+	}
+
+	return offset, limit
+}
@@ -0,0 +1,16 @@
+package archive
+
+const (
+	conversationsBucket = "conversations"
+	titleMaxLength      = 50
+	defaultLimit        = 20
+	ownerSeparator      = "|"
+	tokenIdentityPrefix = "token:"
+	accountOwnerPrefix  = "account:"
+
+	archiveDisabledErrorMessage      = "Archive is not enabled, set GO_CHATGPT_API_ARCHIVE to enable it."
+	getConversationsErrorMessage     = "Failed to get archived conversations."
+	conversationNotFoundErrorMessage = "Archived conversation is not found."
+	emptyQueryErrorMessage           = "Search query must not be empty."
+	unknownOwnerErrorMessage         = "Authorization is required to read the archive."
+)
@@ -0,0 +1,126 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/linweiyuan/go-chatgpt-api/util/logger"
+	bolt "go.etcd.io/bbolt"
+)
+
+var db *bolt.DB
+
+//goland:noinspection SpellCheckingInspection
+func init() {
+	path := os.Getenv("GO_CHATGPT_API_ARCHIVE")
+	if path == "" {
+		return
+	}
+
+	var err error
+	db, err = bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		logger.Error("Failed to open archive: " + err.Error())
+		os.Exit(1)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(conversationsBucket))
+		return err
+	})
+	if err != nil {
+		logger.Error("Failed to init archive: " + err.Error())
+		os.Exit(1)
+	}
+
+	logger.Info("GO_CHATGPT_API_ARCHIVE: " + path)
+}
+
+func Enabled() bool {
+	return db != nil
+}
+
+// the conversations are stored per owner (the caller identity of the rate limiter),
+// a caller only sees its own conversations
+func conversationKey(owner string, conversationID string) []byte {
+	return []byte(owner + ownerSeparator + conversationID)
+}
+
+// Save appends the message to the archived conversation of the owner, the conversation is created if not exists
+func Save(owner string, conversationID string, message Message) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(conversationsBucket))
+
+		var conversation Conversation
+		if data := bucket.Get(conversationKey(owner, conversationID)); data != nil {
+			if err := json.Unmarshal(data, &conversation); err != nil {
+				return err
+			}
+		} else {
+			conversation = Conversation{
+				ID:         conversationID,
+				Title:      title(message.Prompt),
+				CreateTime: message.CreateTime,
+			}
+		}
+
+		conversation.UpdateTime = message.FinishTime
+		conversation.Messages = append(conversation.Messages, message)
+		data, err := json.Marshal(conversation)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(conversationKey(owner, conversationID), data)
+	})
+}
+
+func getConversation(owner string, conversationID string) (*Conversation, error) {
+	var conversation *Conversation
+	err := db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(conversationsBucket)).Get(conversationKey(owner, conversationID))
+		if data == nil {
+			return nil
+		}
+
+		conversation = &Conversation{}
+		return json.Unmarshal(data, conversation)
+	})
+	return conversation, err
+}
+
+// getConversations returns all archived conversations of the owner, the latest updated first
+func getConversations(owner string) ([]Conversation, error) {
+	var conversations []Conversation
+	err := db.View(func(tx *bolt.Tx) error {
+		prefix := conversationKey(owner, "")
+		cursor := tx.Bucket([]byte(conversationsBucket)).Cursor()
+		for key, data := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, data = cursor.Next() {
+			var conversation Conversation
+			if err := json.Unmarshal(data, &conversation); err != nil {
+				return err
+			}
+
+			conversations = append(conversations, conversation)
+		}
+		return nil
+	})
+
+	sort.Slice(conversations, func(i, j int) bool {
+		return conversations[i].UpdateTime.After(conversations[j].UpdateTime)
+	})
+	return conversations, err
+}
+
+func title(prompt string) string {
+	runes := []rune(strings.TrimSpace(prompt))
+	if len(runes) > titleMaxLength {
+		return string(runes[:titleMaxLength])
+	}
+
+	return string(runes)
+}
@@ -0,0 +1,50 @@
+package archive
+
+import "time"
+
+type Conversation struct {
+	ID         string    `json:"id"`
+	Title      string    `json:"title"`
+	CreateTime time.Time `json:"create_time"`
+	UpdateTime time.Time `json:"update_time"`
+	Messages   []Message `json:"messages"`
+}
+
+// Message is one round trip, the prompt of the request and the final assistant message
+type Message struct {
+	ID              string    `json:"id"`
+	ParentMessageID string    `json:"parent_message_id"`
+	Model           string    `json:"model"`
+	ModelSlug       string    `json:"model_slug"`
+	Prompt          string    `json:"prompt"`
+	Response        string    `json:"response"`
+	FinishReason    string    `json:"finish_reason"`
+	CreateTime      time.Time `json:"create_time"`
+	FinishTime      time.Time `json:"finish_time"`
+}
+
+type ConversationItem struct {
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	CreateTime   time.Time `json:"create_time"`
+	UpdateTime   time.Time `json:"update_time"`
+	MessageCount int       `json:"message_count"`
+}
+
+type ListConversationsResponse struct {
+	Items  []ConversationItem `json:"items"`
+	Total  int                `json:"total"`
+	Limit  int                `json:"limit"`
+	Offset int                `json:"offset"`
+}
+
+type SearchResult struct {
+	ConversationID string  `json:"conversation_id"`
+	Title          string  `json:"title"`
+	Message        Message `json:"message"`
+}
+
+type SearchConversationsResponse struct {
+	Items []SearchResult `json:"items"`
+	Total int            `json:"total"`
+}
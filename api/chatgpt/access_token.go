@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
@@ -24,7 +25,7 @@ func (userLogin *UserLogin) GetAuthorizedUrl(csrfToken string) (string, int, err
 	req.Header.Set("User-Agent", api.UserAgent)
 	resp, err := userLogin.client.Do(req)
 	if err != nil {
-		return "", http.StatusInternalServerError, err
+		return "", api.ErrorStatusCode(err), err
 	}
 
 	defer resp.Body.Close()
@@ -44,7 +45,7 @@ func (userLogin *UserLogin) GetState(authorizedUrl string) (string, int, error)
 	req.Header.Set("User-Agent", api.UserAgent)
 	resp, err := userLogin.client.Do(req)
 	if err != nil {
-		return "", http.StatusInternalServerError, err
+		return "", api.ErrorStatusCode(err), err
 	}
 
 	defer resp.Body.Close()
@@ -54,6 +55,7 @@ func (userLogin *UserLogin) GetState(authorizedUrl string) (string, int, error)
 
 	doc, _ := goquery.NewDocumentFromReader(resp.Body)
 	state, _ := doc.Find("input[name=state]").Attr("value")
+	userLogin.captchaImage, _ = doc.Find("img[alt=captcha]").Attr("src")
 	return state, http.StatusOK, nil
 }
 
@@ -64,12 +66,15 @@ func (userLogin *UserLogin) CheckUsername(state string, username string) (int, e
 		state,
 		username,
 	)
+	if userLogin.captcha != "" {
+		formParams += "&captcha=" + url.QueryEscape(userLogin.captcha)
+	}
 	req, _ := http.NewRequest(http.MethodPost, api.LoginUsernameUrl+state, strings.NewReader(formParams))
 	req.Header.Set("Content-Type", api.ContentType)
 	req.Header.Set("User-Agent", api.UserAgent)
 	resp, err := userLogin.client.Do(req)
 	if err != nil {
-		return http.StatusInternalServerError, err
+		return api.ErrorStatusCode(err), err
 	}
 
 	defer resp.Body.Close()
@@ -94,7 +99,7 @@ func (userLogin *UserLogin) CheckPassword(state string, username string, passwor
 	userLogin.client.SetFollowRedirect(false)
 	resp, err := userLogin.client.Do(req)
 	if err != nil {
-		return "", http.StatusInternalServerError, err
+		return "", api.ErrorStatusCode(err), err
 	}
 
 	defer resp.Body.Close()
@@ -109,46 +114,89 @@ func (userLogin *UserLogin) CheckPassword(state string, username string, passwor
 	}
 
 	if resp.StatusCode == http.StatusFound {
-		req, _ := http.NewRequest(http.MethodGet, api.Auth0Url+resp.Header.Get("Location"), nil)
+		return userLogin.resumeAuthorization(resp.Header.Get("Location"), api.EmailOrPasswordInvalidErrorMessage)
+	}
+
+	return "", resp.StatusCode, nil
+}
+
+func (userLogin *UserLogin) CheckOTP(state string, otp string) (string, int, error) {
+	return userLogin.checkChallengeCode(api.LoginMfaOtpChallengePath, state, otp)
+}
+
+// checkChallengeCode answers the code challenge (OTP or email) of Auth0
+//
+//goland:noinspection GoUnhandledErrorResult,GoErrorStringFormat
+func (userLogin *UserLogin) checkChallengeCode(challengePath string, state string, code string) (string, int, error) {
+	formParams := fmt.Sprintf(
+		"state=%s&code=%s&action=default",
+		state,
+		code,
+	)
+	req, _ := http.NewRequest(http.MethodPost, api.Auth0Url+challengePath+"?state="+state, strings.NewReader(formParams))
+	req.Header.Set("Content-Type", api.ContentType)
+	req.Header.Set("User-Agent", api.UserAgent)
+	userLogin.client.SetFollowRedirect(false)
+	resp, err := userLogin.client.Do(req)
+	if err != nil {
+		return "", api.ErrorStatusCode(err), err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusFound {
+		return userLogin.resumeAuthorization(resp.Header.Get("Location"), api.OTPInvalidErrorMessage)
+	}
+
+	return "", http.StatusBadRequest, errors.New(api.OTPInvalidErrorMessage)
+}
+
+// resumeAuthorization follows the redirects after the password (or the OTP) is accepted until the session cookie is set
+//
+//goland:noinspection GoUnhandledErrorResult,GoErrorStringFormat
+func (userLogin *UserLogin) resumeAuthorization(location string, errorMessage string) (string, int, error) {
+	req, _ := http.NewRequest(http.MethodGet, api.Auth0Url+location, nil)
+	req.Header.Set("User-Agent", api.UserAgent)
+	resp, err := userLogin.client.Do(req)
+	if err != nil {
+		return "", api.ErrorStatusCode(err), err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusFound {
+		location := resp.Header.Get("Location")
+		if strings.HasPrefix(location, api.LoginMfaOtpChallengePath) {
+			challengeUrl, _ := url.Parse(location)
+			return challengeUrl.Query().Get("state"), http.StatusBadRequest, api.ErrOTPRequired
+		}
+
+		if strings.HasPrefix(location, api.LoginMfaEmailChallengePath) {
+			challengeUrl, _ := url.Parse(location)
+			return challengeUrl.Query().Get("state"), http.StatusBadRequest, api.ErrEmailCodeRequired
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, location, nil)
 		req.Header.Set("User-Agent", api.UserAgent)
 		resp, err := userLogin.client.Do(req)
 		if err != nil {
-			return "", http.StatusInternalServerError, err
+			return "", api.ErrorStatusCode(err), err
 		}
 
 		defer resp.Body.Close()
 		if resp.StatusCode == http.StatusFound {
-			location := resp.Header.Get("Location")
-			if strings.HasPrefix(location, "/u/mfa-otp-challenge") {
-				return "", http.StatusBadRequest, errors.New("Login with two-factor authentication enabled is not supported currently.")
-			}
-
-			req, _ := http.NewRequest(http.MethodGet, location, nil)
-			req.Header.Set("User-Agent", api.UserAgent)
-			resp, err := userLogin.client.Do(req)
-			if err != nil {
-				return "", http.StatusInternalServerError, err
-			}
-
-			defer resp.Body.Close()
-			if resp.StatusCode == http.StatusFound {
-				return "", http.StatusOK, nil
-			}
+			return "", http.StatusOK, nil
+		}
 
-			if resp.StatusCode == http.StatusTemporaryRedirect {
-				errorDescription := req.URL.Query().Get("error_description")
-				if errorDescription != "" {
-					return "", resp.StatusCode, errors.New(errorDescription)
-				}
+		if resp.StatusCode == http.StatusTemporaryRedirect {
+			errorDescription := req.URL.Query().Get("error_description")
+			if errorDescription != "" {
+				return "", resp.StatusCode, errors.New(errorDescription)
 			}
-
-			return "", resp.StatusCode, errors.New(api.GetAccessTokenErrorMessage)
 		}
 
-		return "", resp.StatusCode, errors.New(api.EmailOrPasswordInvalidErrorMessage)
+		return "", resp.StatusCode, errors.New(api.GetAccessTokenErrorMessage)
 	}
 
-	return "", resp.StatusCode, nil
+	return "", resp.StatusCode, errors.New(errorMessage)
 }
 
 //goland:noinspection GoUnhandledErrorResult,GoErrorStringFormat,GoUnusedParameter
@@ -157,7 +205,7 @@ func (userLogin *UserLogin) GetAccessToken(code string) (string, int, error) {
 	req.Header.Set("User-Agent", api.UserAgent)
 	resp, err := userLogin.client.Do(req)
 	if err != nil {
-		return "", http.StatusInternalServerError, err
+		return "", api.ErrorStatusCode(err), err
 	}
 
 	defer resp.Body.Close()
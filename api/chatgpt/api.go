@@ -3,102 +3,18 @@ package chatgpt
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	http "github.com/bogdanfinn/fhttp"
 	"github.com/gin-gonic/gin"
 	"github.com/linweiyuan/go-chatgpt-api/api"
+	"github.com/linweiyuan/go-chatgpt-api/util/logger"
 	"io"
-	"io/ioutil"
 	"log"
-	"os"
 	"strings"
 )
 
-var (
-	arkoseTokenUrl string
-)
-
-//goland:noinspection SpellCheckingInspection
-func init() {
-	arkoseTokenUrl = os.Getenv("GO_CHATGPT_API_ARKOSE_TOKEN_URL")
-}
-
-func getArkoseToken() (string, error) {
-	paramsURL := "https://ai.fakeopen.com/api/arkose/params?format=all"
-	headers := map[string]string{
-		"User-Agent": "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.4 Safari/605.1.15",
-	}
-
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", paramsURL, nil)
-	if err != nil {
-		return "", err
-	}
-
-	for k, v := range headers {
-		req.Header.Set(k, v)
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		bodyBytes, _ := ioutil.ReadAll(resp.Body)
-		return "", fmt.Errorf("failed to get arkose params: %d %s", resp.StatusCode, string(bodyBytes))
-	}
-
-	var data map[string]interface{}
-	err = json.NewDecoder(resp.Body).Decode(&data)
-	if err != nil {
-		return "", err
-	}
-
-	if _, ok := data["endpoint"].(string); !ok {
-		return "", fmt.Errorf("invalid arkose params: %v", data)
-	}
-
-	_, _ = json.Marshal(data["headers"])
-	formJSON, _ := json.Marshal(data["form"])
-
-	req, err = http.NewRequest("POST", data["endpoint"].(string), strings.NewReader(string(formJSON)))
-	if err != nil {
-		return "", err
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	for k, v := range headers {
-		req.Header.Set(k, v)
-	}
-
-	resp, err = client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		bodyBytes, _ := ioutil.ReadAll(resp.Body)
-		return "", fmt.Errorf("failed to get arkose token: %d %s", resp.StatusCode, string(bodyBytes))
-	}
-
-	err = json.NewDecoder(resp.Body).Decode(&data)
-	if err != nil {
-		return "", err
-	}
-
-	token, ok := data["token"].(string)
-	if !ok {
-		return "", fmt.Errorf("failed to get arkose token: %v", data)
-	}
-
-	return token, nil
-}
-
-
 //goland:noinspection GoUnhandledErrorResult
 func GetConversations(c *gin.Context) {
 	offset, ok := c.GetQuery("offset")
@@ -128,20 +44,13 @@ func CreateConversation(c *gin.Context) {
 		request.Messages[0].Author.Role = defaultRole
 	}
 
-	if strings.HasPrefix(request.Model, gpt4Model) {
-		if arkoseTokenUrl != "" {
-			req, _ := http.NewRequest(http.MethodGet, arkoseTokenUrl, nil)
-			resp, err := api.Client.Do(req)
-			if err != nil || resp.StatusCode != http.StatusOK {
-				c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage("Failed to get arkose token."))
-				return
-			}
-			responseMap := make(map[string]string)
-			json.NewDecoder(resp.Body).Decode(&responseMap)
-			request.ArkoseToken = responseMap["token"]
-		} else {
-			request.ArkoseToken, _ = getArkoseToken()
-		}
+	request.sessionKey = c.GetHeader(sessionKeyHeader)
+	if request.sessionKey != "" {
+		loadConversationSession(c, &request)
+	}
+
+	if done := setArkoseToken(c, &request); done {
+		return
 	}
 
 	resp, done := sendConversationRequest(c, request)
@@ -194,7 +103,8 @@ func FeedbackMessage(c *gin.Context) {
 	}
 
 	jsonBytes, _ := json.Marshal(request)
-	handlePost(c, apiPrefix+"/conversation/message_feedback", string(jsonBytes), feedbackMessageErrorMessage)
+	req, _ := http.NewRequest(http.MethodPost, apiPrefix+"/conversation/message_feedback", strings.NewReader(string(jsonBytes)))
+	handlePostOrPatch(c, req, request.ConversationID, feedbackMessageErrorMessage)
 }
 
 //goland:noinspection GoUnhandledErrorResult
@@ -214,15 +124,74 @@ func GetAccountCheck(c *gin.Context) {
 	handleGet(c, apiPrefix+"/accounts/check", getAccountCheckErrorMessage)
 }
 
+// fetchConversation gets the conversation with the mapping tree, the response is not relayed
+func fetchConversation(ctx context.Context, accessToken string, conversationID string) (*GetConversationResponse, int, error) {
+	data, statusCode, err := fetchData(ctx, accessToken, conversationID, apiPrefix+"/conversation/"+conversationID, getContentErrorMessage)
+	if err != nil {
+		return nil, statusCode, err
+	}
+
+	var response GetConversationResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, http.StatusInternalServerError, errors.New(getContentErrorMessage)
+	}
+
+	return &response, http.StatusOK, nil
+}
+
+//goland:noinspection GoUnhandledErrorResult,GoErrorStringFormat
+func fetchData(ctx context.Context, accessToken string, conversationID string, url string, errorMessage string) ([]byte, int, error) {
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("User-Agent", api.UserAgent)
+	resp, err := api.DoWithRetry(ctx, api.RetryGroupChatGPT, req, func(req *http.Request) (*http.Response, error) {
+		return api.DoWithAccessToken(req, accessToken, conversationID)
+	})
+	if err != nil {
+		return nil, api.ErrorStatusCode(err), err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode, errors.New(errorMessage)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return data, http.StatusOK, nil
+}
+
+// hideConversation uses the same API as UpdateConversation, the response is not relayed
+//
+//goland:noinspection GoUnhandledErrorResult
+func hideConversation(c *gin.Context, conversationID string) {
+	jsonBytes, _ := json.Marshal(PatchConversationRequest{
+		IsVisible: false,
+	})
+	req, _ := http.NewRequest(http.MethodPatch, apiPrefix+"/conversation/"+conversationID, bytes.NewReader(jsonBytes))
+	req.Header.Set("User-Agent", api.UserAgent)
+	resp, err := api.DoWithAccessToken(req, c.GetHeader(api.AuthorizationHeader), conversationID)
+	if err != nil {
+		logger.Error(updateConversationErrorMessage + " " + err.Error())
+		return
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		logger.Error(updateConversationErrorMessage)
+	}
+}
+
 //goland:noinspection GoUnhandledErrorResult
 func handleGet(c *gin.Context, url string, errorMessage string) {
 	req, _ := http.NewRequest(http.MethodGet, url, nil)
 	req.Header.Set("User-Agent", api.UserAgent)
-	req.Header.Set("Authorization", api.GetAccessToken(c.GetHeader(api.AuthorizationHeader)))
 	req.Header.Set("Accept", "text/event-stream")
-	resp, err := api.Client.Do(req)
+	resp, err := doWithRetry(c, api.RetryGroupChatGPT, req, c.Param("id"))
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(err.Error()))
+		api.AbortWithClientError(c, err)
 		return
 	}
 
@@ -240,24 +209,23 @@ func handleGet(c *gin.Context, url string, errorMessage string) {
 //goland:noinspection GoUnhandledErrorResult
 func handlePost(c *gin.Context, url string, requestBody string, errorMessage string) {
 	req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(requestBody))
-	handlePostOrPatch(c, req, errorMessage)
+	handlePostOrPatch(c, req, c.Param("id"), errorMessage)
 }
 
 //goland:noinspection GoUnhandledErrorResult
 func handlePatch(c *gin.Context, url string, requestBody string, errorMessage string) {
 	req, _ := http.NewRequest(http.MethodPatch, url, strings.NewReader(requestBody))
-	handlePostOrPatch(c, req, errorMessage)
+	handlePostOrPatch(c, req, c.Param("id"), errorMessage)
 }
 
 //goland:noinspection GoUnhandledErrorResult
-func handlePostOrPatch(c *gin.Context, req *http.Request, errorMessage string) {
+func handlePostOrPatch(c *gin.Context, req *http.Request, conversationID string, errorMessage string) {
 	req.Header.Set("User-Agent", api.UserAgent)
-	req.Header.Set("Authorization", api.GetAccessToken(c.GetHeader(api.AuthorizationHeader)))
-	resp, err := api.Client.Do(req)
+	resp, err := doWithRetry(c, api.RetryGroupChatGPT, req, conversationID)
 	log.Println("patch req", req)
 	log.Println("patch resp", resp)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(err.Error()))
+		api.AbortWithClientError(c, err)
 		return
 	}
 
@@ -270,24 +238,52 @@ func handlePostOrPatch(c *gin.Context, req *http.Request, errorMessage string) {
 	io.Copy(c.Writer, resp.Body)
 }
 
-//goland:noinspection GoUnhandledErrorResult
 func sendConversationRequest(c *gin.Context, request CreateConversationRequest) (*http.Response, bool) {
+	return doSendConversationRequest(c, request, c.GetHeader(api.AuthorizationHeader), false)
+}
+
+//goland:noinspection GoUnhandledErrorResult
+func doSendConversationRequest(c *gin.Context, request CreateConversationRequest, accessToken string, arkoseRetried bool) (*http.Response, bool) {
 	jsonBytes, _ := json.Marshal(request)
 	req, _ := http.NewRequest(http.MethodPost, api.ChatGPTApiUrlPrefix+"/backend-api/conversation", bytes.NewBuffer(jsonBytes))
 	req.Header.Set("User-Agent", api.UserAgent)
-	req.Header.Set("Authorization", api.GetAccessToken(c.GetHeader(api.AuthorizationHeader)))
 	req.Header.Set("Accept", "text/event-stream")
-	resp, err := api.Client.Do(req)
+	conversationID := ""
+	if request.ConversationID != nil {
+		conversationID = *request.ConversationID
+	}
+	resp, err := api.DoWithRetry(c.Request.Context(), api.RetryGroupConversation, req, func(req *http.Request) (*http.Response, error) {
+		return api.DoWithAccessToken(req, accessToken, conversationID)
+	})
 	log.Println("conversation req: ", req)
 	log.Println("conversation resp: ", resp)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(err.Error()))
+		api.AbortWithClientError(c, err)
 		return nil, true
 	}
 
 	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+
+		// the model may require an Arkose token which is not known in advance, or the token is expired,
+		// so a fresh one is fetched and the request is sent again only once
+		if resp.StatusCode == http.StatusForbidden && !arkoseRetried && strings.Contains(strings.ToLower(string(data)), api.ArkoseRequiredKeyword) {
+			token, err := getArkoseToken(c.Request.Context())
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(err.Error()))
+				return nil, true
+			}
+
+			// the token which is rejected (a pooled one if the caller uses a pool key) is used again
+			rejectedAccessToken := req.Header.Get(api.AuthorizationHeader)
+			markArkoseRequired(rejectedAccessToken, request.Model)
+			request.ArkoseToken = token
+			return doSendConversationRequest(c, request, rejectedAccessToken, true)
+		}
+
 		responseMap := make(map[string]interface{})
-		json.NewDecoder(resp.Body).Decode(&responseMap)
+		json.Unmarshal(data, &responseMap)
 		c.AbortWithStatusJSON(resp.StatusCode, responseMap)
 		return nil, true
 	}
@@ -295,13 +291,144 @@ func sendConversationRequest(c *gin.Context, request CreateConversationRequest)
 	return resp, false
 }
 
+// doWithRetry sends the request with the access token of the caller by the retry policy of the group
+func doWithRetry(c *gin.Context, group string, req *http.Request, conversationID string) (*http.Response, error) {
+	return api.DoWithRetry(c.Request.Context(), group, req, func(req *http.Request) (*http.Response, error) {
+		return api.DoWithAccessToken(req, c.GetHeader(api.AuthorizationHeader), conversationID)
+	})
+}
+
 //goland:noinspection GoUnhandledErrorResult
 func handleConversationResponse(c *gin.Context, resp *http.Response, request CreateConversationRequest) {
+	request.recorder = newConversationRecorder(request)
+	defer request.recorder.save(c)
+
+	if request.Buffered {
+		handleConversationBufferedResponse(c, resp, request)
+		return
+	}
+
 	c.Writer.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
 
+	if request.Delta {
+		handleConversationDeltaResponse(c, resp, request)
+		return
+	}
+
+	readConversationResponse(c, resp, request, func(line string, _ *CreateConversationResponse) {
+		writeConversationEvent(c, line)
+	})
+}
+
+// handleConversationDeltaResponse only sends the newly appended text of the assistant message,
+// followed by a finish event with the full text when the stream (and the auto continue rounds) ends
+//
+//goland:noinspection GoUnhandledErrorResult
+func handleConversationDeltaResponse(c *gin.Context, resp *http.Response, request CreateConversationRequest) {
+	tracker := newMessageTextTracker()
+	var last *CreateConversationResponse
+	readConversationResponse(c, resp, request, func(line string, response *CreateConversationResponse) {
+		if response == nil {
+			return
+		}
+
+		if !isAssistantTextMessage(response) {
+			if response.Error != nil {
+				writeConversationEvent(c, line)
+			}
+			return
+		}
+
+		last = response
+		delta := tracker.update(response.Message.ID, response.Message.Content.Parts[0])
+		if delta == "" {
+			return
+		}
+
+		jsonBytes, _ := json.Marshal(ConversationDeltaResponse{
+			Type:           deltaTypeDelta,
+			ConversationID: response.ConversationID,
+			MessageID:      response.Message.ID,
+			Delta:          delta,
+		})
+		writeConversationEvent(c, "data: "+string(jsonBytes))
+	})
+
+	if c.IsAborted() {
+		return
+	}
+
+	if last != nil {
+		message := last.Message
+		jsonBytes, _ := json.Marshal(ConversationDeltaResponse{
+			Type:           deltaTypeFinish,
+			ConversationID: last.ConversationID,
+			MessageID:      message.ID,
+			Text:           tracker.fullText(),
+			ModelSlug:      message.Metadata.ModelSlug,
+			FinishReason:   message.Metadata.FinishDetails.Type,
+		})
+		writeConversationEvent(c, "data: "+string(jsonBytes))
+	}
+	writeConversationEvent(c, "data: "+streamDone)
+}
+
+// handleConversationBufferedResponse consumes the whole event stream (and the auto continue rounds) server side,
+// then returns the last assistant message with the full text as a single json
+func handleConversationBufferedResponse(c *gin.Context, resp *http.Response, request CreateConversationRequest) {
+	tracker := newMessageTextTracker()
+	var last *CreateConversationResponse
+	var errorResponse *CreateConversationResponse
+	readConversationResponse(c, resp, request, func(_ string, response *CreateConversationResponse) {
+		if response == nil {
+			return
+		}
+
+		if response.Error != nil {
+			errorResponse = response
+			return
+		}
+
+		if isAssistantTextMessage(response) {
+			last = response
+			tracker.update(response.Message.ID, response.Message.Content.Parts[0])
+		}
+	})
+
+	if c.IsAborted() {
+		return
+	}
+
+	if last == nil {
+		if errorResponse != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, errorResponse)
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(emptyConversationResponseErrorMessage))
+		return
+	}
+
+	last.Message.Content.Parts = []string{tracker.fullText()}
+	c.JSON(http.StatusOK, last)
+}
+
+//goland:noinspection GoUnhandledErrorResult
+func writeConversationEvent(c *gin.Context, line string) {
+	c.Writer.Write([]byte(line + "\n\n"))
+	c.Writer.Flush()
+}
+
+// readConversationResponse reads the backend event stream (and the auto continue rounds if needed),
+// every data line is passed to handle, response is nil if the line is not a message (e.g. [DONE])
+//
+//goland:noinspection GoUnhandledErrorResult
+func readConversationResponse(c *gin.Context, resp *http.Response, request CreateConversationRequest, handle conversationLineHandler) {
 	isMaxTokens := false
 	continueParentMessageID := ""
 	continueConversationID := ""
+	lastMessageID := ""
+	lastConversationID := ""
 
 	defer resp.Body.Close()
 	reader := bufio.NewReader(resp.Body)
@@ -323,24 +450,46 @@ func handleConversationResponse(c *gin.Context, resp *http.Response, request Cre
 		}
 
 		responseJson := line[6:]
-		if strings.HasPrefix(responseJson, "[DONE]") && isMaxTokens && request.AutoContinue {
+		if strings.HasPrefix(responseJson, "[DONE]") {
+			if isMaxTokens && request.AutoContinue {
+				continue
+			}
+
+			handle(line, nil)
 			continue
 		}
 
-		// no need to unmarshal every time, but if response content has this "max_tokens", need to further check
-		if strings.TrimSpace(responseJson) != "" && strings.Contains(responseJson, responseTypeMaxTokens) {
-			var createConversationResponse CreateConversationResponse
-			json.Unmarshal([]byte(responseJson), &createConversationResponse)
-			message := createConversationResponse.Message
-			if message.Metadata.FinishDetails.Type == responseTypeMaxTokens && createConversationResponse.Message.Status == responseStatusFinishedSuccessfully {
-				isMaxTokens = true
-				continueParentMessageID = message.ID
-				continueConversationID = createConversationResponse.ConversationID
-			}
+		var createConversationResponse CreateConversationResponse
+		if err := json.Unmarshal([]byte(responseJson), &createConversationResponse); err != nil {
+			handle(line, nil)
+			continue
 		}
 
-		c.Writer.Write([]byte(line + "\n\n"))
-		c.Writer.Flush()
+		if request.recorder != nil {
+			request.recorder.record(&createConversationResponse)
+		}
+
+		message := createConversationResponse.Message
+		if message.ID != "" && createConversationResponse.ConversationID != "" {
+			lastMessageID = message.ID
+			lastConversationID = createConversationResponse.ConversationID
+		}
+
+		if message.Metadata.FinishDetails.Type == responseTypeMaxTokens && message.Status == responseStatusFinishedSuccessfully {
+			isMaxTokens = true
+			continueParentMessageID = message.ID
+			continueConversationID = createConversationResponse.ConversationID
+		}
+
+		handle(line, &createConversationResponse)
+	}
+
+	if lastConversationID != "" {
+		api.PinConversation(c.GetHeader(api.AuthorizationHeader), lastConversationID, resp.Request)
+	}
+
+	if request.sessionKey != "" && lastMessageID != "" {
+		saveConversationSession(c, request.sessionKey, lastConversationID, lastMessageID)
 	}
 
 	if isMaxTokens && request.AutoContinue {
@@ -349,6 +498,8 @@ func handleConversationResponse(c *gin.Context, resp *http.Response, request Cre
 			HistoryAndTrainingDisabled: request.HistoryAndTrainingDisabled,
 			Model:                      request.Model,
 			TimezoneOffsetMin:          request.TimezoneOffsetMin,
+			sessionKey:                 request.sessionKey,
+			recorder:                   request.recorder,
 
 			Action:          actionContinue,
 			ParentMessageID: continueParentMessageID,
@@ -359,6 +510,70 @@ func handleConversationResponse(c *gin.Context, resp *http.Response, request Cre
 			return
 		}
 
-		handleConversationResponse(c, resp, continueConversationRequest)
+		readConversationResponse(c, resp, continueConversationRequest, handle)
 	}
-}
\ No newline at end of file
+}
+
+// readAssistantTextResponse passes the newly appended text of the assistant message to handleDelta,
+// then returns the full text and the finish type of the last assistant message,
+// the conversation is recorded the same as CreateConversation when the stream ends
+func readAssistantTextResponse(c *gin.Context, resp *http.Response, request CreateConversationRequest, handleDelta func(delta string)) assistantTextResponse {
+	request.recorder = newConversationRecorder(request)
+	tracker := newMessageTextTracker()
+	var result assistantTextResponse
+	readConversationResponse(c, resp, request, func(_ string, response *CreateConversationResponse) {
+		if response == nil || !isAssistantTextMessage(response) {
+			return
+		}
+
+		message := response.Message
+		result.conversationID = response.ConversationID
+		result.messageID = message.ID
+		if message.Metadata.FinishDetails.Type != "" {
+			result.finishType = message.Metadata.FinishDetails.Type
+		}
+
+		delta := tracker.update(message.ID, message.Content.Parts[0])
+		if delta != "" {
+			handleDelta(delta)
+		}
+	})
+
+	request.recorder.save(c)
+	result.text = tracker.fullText()
+	return result
+}
+
+func newMessageTextTracker() *messageTextTracker {
+	return &messageTextTracker{
+		last: make(map[string]string),
+		text: make(map[string]string),
+	}
+}
+
+// update returns the newly appended text of the message, a continue round which starts over is appended as a whole
+func (tracker *messageTextTracker) update(messageID string, text string) string {
+	last, ok := tracker.last[messageID]
+	if !ok {
+		tracker.messageIDs = append(tracker.messageIDs, messageID)
+	}
+
+	delta := text
+	if strings.HasPrefix(text, last) {
+		delta = text[len(last):]
+	}
+
+	tracker.last[messageID] = text
+	tracker.text[messageID] += delta
+	return delta
+}
+
+// fullText joins the text of every message in order, a continue round may come back with a new message id
+func (tracker *messageTextTracker) fullText() string {
+	var builder strings.Builder
+	for _, messageID := range tracker.messageIDs {
+		builder.WriteString(tracker.text[messageID])
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,63 @@
+package chatgpt
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/linweiyuan/go-chatgpt-api/api/archive"
+	"github.com/linweiyuan/go-chatgpt-api/api/limiter"
+	"github.com/linweiyuan/go-chatgpt-api/util/logger"
+)
+
+func newConversationRecorder(request CreateConversationRequest) *conversationRecorder {
+	prompts := make([]string, 0, len(request.Messages))
+	for _, message := range request.Messages {
+		prompts = append(prompts, strings.Join(message.Content.Parts, "\n"))
+	}
+
+	return &conversationRecorder{
+		tracker: newMessageTextTracker(),
+		message: archive.Message{
+			ParentMessageID: request.ParentMessageID,
+			Model:           request.Model,
+			Prompt:          strings.Join(prompts, "\n"),
+			CreateTime:      time.Now(),
+		},
+	}
+}
+
+func (recorder *conversationRecorder) record(response *CreateConversationResponse) {
+	if !isAssistantTextMessage(response) {
+		return
+	}
+
+	message := response.Message
+	recorder.conversationID = response.ConversationID
+	recorder.message.ID = message.ID
+	recorder.message.ModelSlug = message.Metadata.ModelSlug
+	if message.Metadata.FinishDetails.Type != "" {
+		recorder.message.FinishReason = message.Metadata.FinishDetails.Type
+	}
+	recorder.tracker.update(message.ID, message.Content.Parts[0])
+}
+
+// save counts the estimated tokens of the caller when the response (and the auto continue rounds) ends,
+// the prompt is counted even if no assistant message is returned, then the final assistant message is archived (if enabled)
+func (recorder *conversationRecorder) save(c *gin.Context) {
+	recorder.message.Response = recorder.tracker.fullText()
+	recorder.message.FinishTime = time.Now()
+	limiter.RecordTokens(c, limiter.EstimateTokens(recorder.message.Prompt)+limiter.EstimateTokens(recorder.message.Response))
+
+	if recorder.conversationID == "" {
+		return
+	}
+
+	if !archive.Enabled() || c.GetString(limiter.ContextKey) == "" {
+		return
+	}
+
+	if err := archive.Save(archive.Owner(c), recorder.conversationID, recorder.message); err != nil {
+		logger.Error("Failed to archive conversation: " + err.Error())
+	}
+}
@@ -0,0 +1,316 @@
+package chatgpt
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/linweiyuan/go-chatgpt-api/api"
+	"github.com/linweiyuan/go-chatgpt-api/util/logger"
+
+	http "github.com/bogdanfinn/fhttp"
+)
+
+// ArkoseProvider gets an Arkose token for the conversation request,
+// the providers are tried in order until one returns a token
+type ArkoseProvider interface {
+	Name() string
+	GetToken(ctx context.Context) (string, error)
+}
+
+var (
+	arkoseProviders []ArkoseProvider
+	arkoseTimeout   = defaultArkoseTimeout
+)
+
+//goland:noinspection SpellCheckingInspection
+func init() {
+	if timeout, err := time.ParseDuration(os.Getenv("GO_CHATGPT_API_ARKOSE_TIMEOUT")); err == nil && timeout > 0 {
+		arkoseTimeout = timeout
+	}
+
+	configured := map[string]ArkoseProvider{
+		arkoseProviderFakeOpen: &fakeOpenArkoseProvider{},
+	}
+	if url := os.Getenv("GO_CHATGPT_API_ARKOSE_TOKEN_URL"); url != "" {
+		configured[arkoseProviderUrl] = &httpArkoseProvider{url: url}
+	}
+	if path := os.Getenv("GO_CHATGPT_API_ARKOSE_TOKEN_FILE"); path != "" {
+		configured[arkoseProviderFile] = &staticArkoseProvider{path: path}
+	}
+	if tokens := os.Getenv("GO_CHATGPT_API_ARKOSE_TOKENS"); tokens != "" {
+		configured[arkoseProviderTokens] = &staticArkoseProvider{tokens: splitArkoseTokens(tokens)}
+	}
+	if command := os.Getenv("GO_CHATGPT_API_ARKOSE_TOKEN_COMMAND"); command != "" {
+		configured[arkoseProviderCommand] = &commandArkoseProvider{command: command}
+	}
+
+	// the configured providers go first, the public one is the last fallback if no order is given
+	order := []string{arkoseProviderUrl, arkoseProviderFile, arkoseProviderTokens, arkoseProviderCommand, arkoseProviderFakeOpen}
+	if providers := os.Getenv("GO_CHATGPT_API_ARKOSE_PROVIDERS"); providers != "" {
+		order = strings.Split(providers, ",")
+	}
+
+	var names []string
+	for _, name := range order {
+		name = strings.TrimSpace(name)
+		provider, ok := configured[name]
+		if !ok {
+			// the default order contains the providers which are not configured
+			if os.Getenv("GO_CHATGPT_API_ARKOSE_PROVIDERS") != "" {
+				logger.Error("Arkose provider " + name + " is unknown or not configured.")
+			}
+			continue
+		}
+
+		arkoseProviders = append(arkoseProviders, provider)
+		names = append(names, name)
+	}
+
+	logger.Info("Arkose providers: " + strings.Join(names, " -> "))
+}
+
+// setArkoseToken sets the token for the models which require it (according to the models of the account) if the client does not send one,
+// the request is aborted with the error of each provider if none of them works
+func setArkoseToken(c *gin.Context, request *CreateConversationRequest) bool {
+	conversationID := ""
+	if request.ConversationID != nil {
+		conversationID = *request.ConversationID
+	}
+	if request.ArkoseToken != "" || !requiresArkose(c.Request.Context(), c.GetHeader(api.AuthorizationHeader), conversationID, request.Model) {
+		return false
+	}
+
+	token, err := nextArkoseToken(c.Request.Context())
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(err.Error()))
+		return true
+	}
+
+	request.ArkoseToken = token
+	return false
+}
+
+// getArkoseToken tries the providers in order, each of them has its own timeout
+func getArkoseToken(ctx context.Context) (string, error) {
+	var providerErrors []string
+	for _, provider := range arkoseProviders {
+		token, err := func() (string, error) {
+			ctx, cancel := context.WithTimeout(ctx, arkoseTimeout)
+			defer cancel()
+
+			return provider.GetToken(ctx)
+		}()
+		if err == nil && token == "" {
+			err = errors.New(emptyArkoseTokenErrorMessage)
+		}
+		if err == nil {
+			return token, nil
+		}
+
+		logger.Error("Arkose provider " + provider.Name() + " failed: " + err.Error())
+		providerErrors = append(providerErrors, provider.Name()+": "+err.Error())
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if len(providerErrors) == 0 {
+		return "", errors.New(getArkoseTokenErrorMessage)
+	}
+
+	return "", errors.New(getArkoseTokenErrorMessage + " " + strings.Join(providerErrors, "; "))
+}
+
+// httpArkoseProvider gets the token from a solver, the response is {"token": "..."} or the token in plain text
+type httpArkoseProvider struct {
+	url string
+}
+
+func (provider *httpArkoseProvider) Name() string {
+	return arkoseProviderUrl
+}
+
+//goland:noinspection GoUnhandledErrorResult
+func (provider *httpArkoseProvider) GetToken(ctx context.Context) (string, error) {
+	req, _ := http.NewRequest(http.MethodGet, provider.url, nil)
+	resp, err := api.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status code %d", resp.StatusCode)
+	}
+
+	responseMap := make(map[string]interface{})
+	if err := json.Unmarshal(data, &responseMap); err != nil {
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	token, _ := responseMap["token"].(string)
+	return token, nil
+}
+
+// staticArkoseProvider rotates the given tokens, or the tokens of a file (one per line) which is read again when changed
+type staticArkoseProvider struct {
+	mutex   sync.Mutex
+	path    string
+	modTime time.Time
+	tokens  []string
+	next    int
+}
+
+func (provider *staticArkoseProvider) Name() string {
+	if provider.path != "" {
+		return arkoseProviderFile
+	}
+
+	return arkoseProviderTokens
+}
+
+//goland:noinspection GoUnhandledErrorResult
+func (provider *staticArkoseProvider) GetToken(_ context.Context) (string, error) {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	if provider.path != "" {
+		info, err := os.Stat(provider.path)
+		if err != nil {
+			return "", err
+		}
+
+		if !info.ModTime().Equal(provider.modTime) {
+			file, err := os.Open(provider.path)
+			if err != nil {
+				return "", err
+			}
+
+			var tokens []string
+			scanner := bufio.NewScanner(file)
+			scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+			for scanner.Scan() {
+				tokens = append(tokens, splitArkoseTokens(scanner.Text())...)
+			}
+			file.Close()
+
+			provider.tokens = tokens
+			provider.modTime = info.ModTime()
+			provider.next = 0
+		}
+	}
+
+	if len(provider.tokens) == 0 {
+		return "", errors.New(noArkoseTokenErrorMessage)
+	}
+
+	token := provider.tokens[provider.next%len(provider.tokens)]
+	provider.next++
+	return token, nil
+}
+
+func splitArkoseTokens(value string) []string {
+	var tokens []string
+	for _, token := range strings.Split(value, ",") {
+		token = strings.TrimSpace(token)
+		if token != "" && !strings.HasPrefix(token, "#") {
+			tokens = append(tokens, token)
+		}
+	}
+
+	return tokens
+}
+
+// commandArkoseProvider runs the command with sh, the token is the output
+type commandArkoseProvider struct {
+	command string
+}
+
+func (provider *commandArkoseProvider) Name() string {
+	return arkoseProviderCommand
+}
+
+func (provider *commandArkoseProvider) GetToken(ctx context.Context) (string, error) {
+	output, err := exec.CommandContext(ctx, "sh", "-c", provider.command).Output()
+	if err != nil {
+		var exitError *exec.ExitError
+		if errors.As(err, &exitError) && len(exitError.Stderr) != 0 {
+			return "", errors.New(strings.TrimSpace(string(exitError.Stderr)))
+		}
+
+		return "", err
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// fakeOpenArkoseProvider gets the params from the public service of fakeopen, then solves them
+type fakeOpenArkoseProvider struct{}
+
+func (provider *fakeOpenArkoseProvider) Name() string {
+	return arkoseProviderFakeOpen
+}
+
+//goland:noinspection GoUnhandledErrorResult
+func (provider *fakeOpenArkoseProvider) GetToken(ctx context.Context) (string, error) {
+	req, _ := http.NewRequest(http.MethodGet, fakeOpenArkoseParamsUrl, nil)
+	req.Header.Set("User-Agent", api.UserAgent)
+	resp, err := api.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("failed to get arkose params: %d %s", resp.StatusCode, string(data))
+	}
+
+	var params map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&params); err != nil {
+		return "", err
+	}
+
+	endpoint, ok := params["endpoint"].(string)
+	if !ok {
+		return "", fmt.Errorf("invalid arkose params: %v", params)
+	}
+
+	form, _ := json.Marshal(params["form"])
+	req, _ = http.NewRequest(http.MethodPost, endpoint, strings.NewReader(string(form)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", api.UserAgent)
+	resp, err = api.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("failed to get arkose token: %d %s", resp.StatusCode, string(data))
+	}
+
+	var data map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return "", err
+	}
+
+	token, ok := data["token"].(string)
+	if !ok {
+		return "", fmt.Errorf("failed to get arkose token: %v", data)
+	}
+
+	return token, nil
+}
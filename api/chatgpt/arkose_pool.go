@@ -0,0 +1,175 @@
+package chatgpt
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	http "github.com/bogdanfinn/fhttp"
+)
+
+// the Arkose pool keeps up to the configured depth of tokens fetched by the providers in the background,
+// a request takes the oldest one which is still valid, or fetches one by itself if the pool is empty
+var arkosePool = &arkoseTokenPool{
+	ttl:    defaultArkoseTokenTTL,
+	refill: make(chan struct{}, 1),
+}
+
+type arkoseTokenPool struct {
+	mutex     sync.Mutex
+	depth     int
+	ttl       time.Duration
+	tokens    []pooledArkoseToken
+	refill    chan struct{}
+	hits      int
+	misses    int
+	fetched   int
+	failures  int
+	expired   int
+	lastError string
+}
+
+type pooledArkoseToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+//goland:noinspection SpellCheckingInspection
+func init() {
+	depth, _ := strconv.Atoi(os.Getenv("GO_CHATGPT_API_ARKOSE_POOL_SIZE"))
+	if depth <= 0 {
+		return
+	}
+
+	arkosePool.depth = depth
+	if ttl, err := time.ParseDuration(os.Getenv("GO_CHATGPT_API_ARKOSE_TOKEN_TTL")); err == nil && ttl > 0 {
+		arkosePool.ttl = ttl
+	}
+
+	go arkosePool.run()
+}
+
+// GetArkosePoolStats shows how well the pool keeps up with the requests
+func GetArkosePoolStats(c *gin.Context) {
+	c.JSON(http.StatusOK, arkosePool.stats())
+}
+
+// nextArkoseToken takes a token from the pool, or fetches one with the providers if none is ready
+func nextArkoseToken(ctx context.Context) (string, error) {
+	if token, ok := arkosePool.pop(); ok {
+		return token, nil
+	}
+
+	return getArkoseToken(ctx)
+}
+
+func (pool *arkoseTokenPool) pop() (string, bool) {
+	if pool.depth == 0 {
+		return "", false
+	}
+
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	pool.dropExpired()
+	defer pool.wake()
+	if len(pool.tokens) == 0 {
+		pool.misses++
+		return "", false
+	}
+
+	token := pool.tokens[0]
+	pool.tokens = pool.tokens[1:]
+	pool.hits++
+	return token.token, true
+}
+
+// run fetches the tokens one by one until the pool is full, then waits until a token is taken or about to expire
+func (pool *arkoseTokenPool) run() {
+	for {
+		pool.mutex.Lock()
+		pool.dropExpired()
+		full := len(pool.tokens) >= pool.depth
+		wait := arkosePoolCheckInterval
+		if full && len(pool.tokens) != 0 {
+			if untilExpired := time.Until(pool.tokens[0].expiresAt); untilExpired < wait {
+				wait = untilExpired
+			}
+		}
+		pool.mutex.Unlock()
+
+		if full {
+			select {
+			case <-pool.refill:
+			case <-time.After(wait):
+			}
+			continue
+		}
+
+		fetchTime := time.Now()
+		token, err := getArkoseToken(context.Background())
+
+		pool.mutex.Lock()
+		if err != nil {
+			pool.failures++
+			pool.lastError = err.Error()
+		} else {
+			pool.fetched++
+			pool.tokens = append(pool.tokens, pooledArkoseToken{
+				token:     token,
+				expiresAt: fetchTime.Add(pool.ttl),
+			})
+		}
+		pool.mutex.Unlock()
+
+		if err != nil {
+			time.Sleep(arkosePoolRetryInterval)
+		}
+	}
+}
+
+func (pool *arkoseTokenPool) dropExpired() {
+	now := time.Now()
+	i := 0
+	for i < len(pool.tokens) && !now.Before(pool.tokens[i].expiresAt) {
+		i++
+	}
+	pool.expired += i
+	pool.tokens = pool.tokens[i:]
+}
+
+func (pool *arkoseTokenPool) wake() {
+	select {
+	case pool.refill <- struct{}{}:
+	default:
+	}
+}
+
+func (pool *arkoseTokenPool) stats() ArkosePoolStatsResponse {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	pool.dropExpired()
+	hitRate := 0.0
+	if pool.hits+pool.misses != 0 {
+		hitRate = float64(pool.hits) / float64(pool.hits+pool.misses)
+	}
+
+	return ArkosePoolStatsResponse{
+		Enabled:   pool.depth != 0,
+		Size:      len(pool.tokens),
+		Depth:     pool.depth,
+		TTL:       pool.ttl.String(),
+		Hits:      pool.hits,
+		Misses:    pool.misses,
+		HitRate:   hitRate,
+		Fetched:   pool.fetched,
+		Failures:  pool.failures,
+		Expired:   pool.expired,
+		LastError: pool.lastError,
+	}
+}
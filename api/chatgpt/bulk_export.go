@@ -0,0 +1,314 @@
+package chatgpt
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/linweiyuan/go-chatgpt-api/api"
+	"github.com/linweiyuan/go-chatgpt-api/api/limiter"
+	"github.com/linweiyuan/go-chatgpt-api/util/logger"
+
+	http "github.com/bogdanfinn/fhttp"
+)
+
+// export jobs are kept in memory, a job lists the conversations in background, then the zip is streamed by the download,
+// each conversation is fetched while the zip is written, so nothing is kept on disk
+var (
+	exportJobs      = make(map[string]*exportJob)
+	exportJobsMutex sync.Mutex
+)
+
+// CreateExportJob starts to list all conversations of the account in background
+func CreateExportJob(c *gin.Context) {
+	// all pages must be fetched with the same account
+	accessToken, err := api.ResolveAccessToken(c.GetHeader(api.AuthorizationHeader))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, api.ReturnMessage(err.Error()))
+		return
+	}
+
+	job := &exportJob{
+		id:          api.NewUUID(),
+		owner:       c.GetString(limiter.ContextKey),
+		accessToken: accessToken,
+		status:      exportJobStatusRunning,
+		createTime:  time.Now(),
+	}
+
+	exportJobsMutex.Lock()
+	exportJobs[job.id] = job
+	exportJobsMutex.Unlock()
+
+	go job.run()
+
+	c.JSON(http.StatusOK, job.response())
+}
+
+func GetExportJob(c *gin.Context) {
+	job := getExportJob(c)
+	if job == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, job.response())
+}
+
+// DownloadExportJob streams the zip of the listed conversations, an interrupted download can be started again
+func DownloadExportJob(c *gin.Context) {
+	job := getExportJob(c)
+	if job == nil {
+		return
+	}
+
+	job.mutex.Lock()
+	status := job.status
+	if status == exportJobStatusReady || status == exportJobStatusDone {
+		job.status = exportJobStatusStreaming
+		job.exported = 0
+		job.failed = 0
+		job.err = ""
+		job.finishTime = nil
+	}
+	job.mutex.Unlock()
+
+	switch status {
+	case exportJobStatusReady, exportJobStatusDone:
+	case exportJobStatusStreaming:
+		c.AbortWithStatusJSON(http.StatusConflict, api.ReturnMessage(exportJobStreamingErrorMessage))
+		return
+	default:
+		c.AbortWithStatusJSON(http.StatusConflict, api.ReturnMessage(exportJobNotReadyErrorMessage))
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", `attachment; filename="conversations-`+job.createTime.Format("20060102150405")+`.zip"`)
+	c.Status(http.StatusOK)
+	if err := job.stream(c.Request.Context(), c.Writer); err != nil {
+		// the response is already started, the error is only shown in the job
+		job.finish(exportJobStatusReady, err)
+		return
+	}
+
+	job.finish(exportJobStatusDone, nil)
+}
+
+// getExportJob only returns the job created by the same caller
+func getExportJob(c *gin.Context) *exportJob {
+	exportJobsMutex.Lock()
+	job, ok := exportJobs[c.Param("id")]
+	exportJobsMutex.Unlock()
+
+	if !ok || job.owner == "" || job.owner != c.GetString(limiter.ContextKey) {
+		c.AbortWithStatusJSON(http.StatusNotFound, api.ReturnMessage(exportJobNotFoundErrorMessage))
+		return nil
+	}
+
+	return job
+}
+
+func (job *exportJob) response() ExportJobResponse {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+
+	return ExportJobResponse{
+		JobID:      job.id,
+		Status:     job.status,
+		Total:      job.total,
+		Exported:   job.exported,
+		Failed:     job.failed,
+		Error:      job.err,
+		CreateTime: job.createTime,
+		FinishTime: job.finishTime,
+	}
+}
+
+func (job *exportJob) finish(status string, err error) {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+
+	now := time.Now()
+	job.status = status
+	job.finishTime = &now
+	if err != nil {
+		job.err = err.Error()
+		logger.Error("Failed to export conversations: " + job.err)
+	}
+}
+
+// run lists the conversations, the job expires in a while after that
+func (job *exportJob) run() {
+	time.AfterFunc(exportJobExpireTime, func() {
+		exportJobsMutex.Lock()
+		delete(exportJobs, job.id)
+		exportJobsMutex.Unlock()
+	})
+
+	items, err := listAllConversations(context.Background(), job.accessToken)
+	if err != nil {
+		job.finish(exportJobStatusFailed, err)
+		return
+	}
+
+	job.mutex.Lock()
+	job.items = items
+	job.total = len(items)
+	job.status = exportJobStatusReady
+	job.mutex.Unlock()
+}
+
+// stream writes the zip with the bounded concurrency, the conversations are written in the order they are fetched,
+// the manifest is the last file, it is not written if the download is interrupted
+//
+//goland:noinspection GoUnhandledErrorResult
+func (job *exportJob) stream(ctx context.Context, writer gin.ResponseWriter) error {
+	zipWriter := zip.NewWriter(writer)
+	records := make([]ExportManifestRecord, len(job.items))
+	var zipMutex sync.Mutex
+	var zipErr error
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, exportConcurrency)
+	for i, item := range job.items {
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, item ConversationItem) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+
+			records[i] = ExportManifestRecord{
+				ID:         item.ID,
+				Title:      item.Title,
+				CreateTime: item.CreateTime,
+				UpdateTime: item.UpdateTime,
+			}
+
+			data, markdown, err := exportConversation(ctx, job.accessToken, item.ID)
+			if err != nil {
+				records[i].Error = err.Error()
+				job.mutex.Lock()
+				job.failed++
+				job.mutex.Unlock()
+				return
+			}
+
+			jsonFile := "conversations/" + item.ID + ".json"
+			markdownFile := "conversations/" + item.ID + ".md"
+			zipMutex.Lock()
+			defer zipMutex.Unlock()
+
+			if zipErr != nil {
+				return
+			}
+
+			if zipErr = writeZipFile(zipWriter, jsonFile, data); zipErr != nil {
+				return
+			}
+
+			if zipErr = writeZipFile(zipWriter, markdownFile, []byte(markdown)); zipErr != nil {
+				return
+			}
+
+			if zipErr = zipWriter.Flush(); zipErr != nil {
+				return
+			}
+
+			writer.Flush()
+			records[i].Files = []string{jsonFile, markdownFile}
+			job.mutex.Lock()
+			job.exported++
+			job.mutex.Unlock()
+		}(i, item)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if zipErr != nil {
+		return zipErr
+	}
+
+	job.mutex.Lock()
+	manifest := ExportManifest{
+		CreateTime:    job.createTime,
+		Total:         job.total,
+		Exported:      job.exported,
+		Failed:        job.failed,
+		Conversations: records,
+	}
+	job.mutex.Unlock()
+
+	if err := writeZipJSON(zipWriter, "manifest.json", manifest); err != nil {
+		return err
+	}
+
+	return zipWriter.Close()
+}
+
+// listAllConversations pages through the conversations until exhausted
+func listAllConversations(ctx context.Context, accessToken string) ([]ConversationItem, error) {
+	var items []ConversationItem
+	for offset := 0; ; offset += exportPageLimit {
+		url := fmt.Sprintf("%s/conversations?offset=%d&limit=%d", apiPrefix, offset, exportPageLimit)
+		data, _, err := fetchData(ctx, accessToken, "", url, getConversationsErrorMessage)
+		if err != nil {
+			return nil, err
+		}
+
+		var response GetConversationsResponse
+		if err := json.Unmarshal(data, &response); err != nil {
+			return nil, err
+		}
+
+		items = append(items, response.Items...)
+		if len(response.Items) == 0 || offset+len(response.Items) >= response.Total {
+			return items, nil
+		}
+	}
+}
+
+// exportConversation returns the raw json and the rendered markdown of the conversation
+func exportConversation(ctx context.Context, accessToken string, conversationID string) ([]byte, string, error) {
+	data, _, err := fetchData(ctx, accessToken, conversationID, apiPrefix+"/conversation/"+conversationID, getContentErrorMessage)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var conversation GetConversationResponse
+	if err := json.Unmarshal(data, &conversation); err != nil {
+		return nil, "", err
+	}
+
+	return data, renderMarkdown(newConversationExport(conversationID, &conversation)), nil
+}
+
+func writeZipJSON(zipWriter *zip.Writer, name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeZipFile(zipWriter, name, data)
+}
+
+func writeZipFile(zipWriter *zip.Writer, name string, data []byte) error {
+	writer, err := zipWriter.Create(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write(data)
+	return err
+}
@@ -0,0 +1,181 @@
+package chatgpt
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/linweiyuan/go-chatgpt-api/api"
+	"github.com/linweiyuan/go-chatgpt-api/api/limiter"
+	"github.com/linweiyuan/go-chatgpt-api/api/platform"
+
+	http "github.com/bogdanfinn/fhttp"
+)
+
+// CreateChatCompletions serves the OpenAI chat completions format with the ChatGPT web backend
+//
+//goland:noinspection GoUnhandledErrorResult
+func CreateChatCompletions(c *gin.Context) {
+	var request platform.ChatCompletionsRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, api.ReturnMessage(parseJsonErrorMessage))
+		return
+	}
+
+	if len(request.Messages) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, api.ReturnMessage(emptyMessagesErrorMessage))
+		return
+	}
+
+	conversationRequest := convertChatCompletionsRequest(request)
+	if done := setArkoseToken(c, &conversationRequest); done {
+		return
+	}
+
+	resp, done := sendConversationRequest(c, conversationRequest)
+	if done {
+		return
+	}
+
+	id := chatCompletionsIDPrefix + api.NewUUID()
+	created := time.Now().Unix()
+	roleSent := false
+	response := readAssistantTextResponse(c, resp, conversationRequest, func(delta string) {
+		if !request.Stream {
+			return
+		}
+
+		// the stream is started with the first text, so an empty answer can still be an error
+		if !roleSent {
+			c.Writer.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+			writeChatCompletionsChunk(c, id, created, request.Model, platform.ChatCompletionsDelta{Role: roleAssistant}, nil)
+			roleSent = true
+		}
+		writeChatCompletionsChunk(c, id, created, request.Model, platform.ChatCompletionsDelta{Content: delta}, nil)
+	})
+
+	if c.IsAborted() {
+		return
+	}
+
+	if response.text == "" {
+		c.AbortWithStatusJSON(http.StatusBadGateway, api.ReturnMessage(emptyConversationResponseErrorMessage))
+		return
+	}
+
+	finishReason := convertFinishReason(response.finishType)
+	if request.Stream {
+		writeChatCompletionsChunk(c, id, created, request.Model, platform.ChatCompletionsDelta{}, &finishReason)
+		c.Writer.Write([]byte("data: " + streamDone + "\n\n"))
+		c.Writer.Flush()
+		return
+	}
+
+	// the backend does not report the usage, it is estimated the same as the quotas
+	promptTokens := 0
+	for _, message := range request.Messages {
+		promptTokens += limiter.EstimateTokens(message.Content)
+	}
+	completionTokens := limiter.EstimateTokens(response.text)
+	c.JSON(http.StatusOK, platform.ChatCompletionsResponse{
+		ID:      id,
+		Object:  chatCompletionObject,
+		Created: created,
+		Model:   request.Model,
+		Choices: []platform.ChatCompletionsChoice{{
+			Message: &platform.ChatCompletionsMessage{
+				Role:    roleAssistant,
+				Content: response.text,
+			},
+			FinishReason: &finishReason,
+		}},
+		Usage: &platform.Usage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      promptTokens + completionTokens,
+		},
+	})
+}
+
+func convertChatCompletionsRequest(request platform.ChatCompletionsRequest) CreateConversationRequest {
+	messages := make([]Message, 0, len(request.Messages))
+	for _, message := range request.Messages {
+		messages = append(messages, Message{
+			Author: Author{
+				Role: convertRole(message.Role),
+			},
+			Content: Content{
+				ContentType: contentTypeText,
+				Parts:       []string{message.Content},
+			},
+			ID: api.NewUUID(),
+		})
+	}
+
+	return CreateConversationRequest{
+		Action:          actionNext,
+		Messages:        messages,
+		Model:           convertModel(request.Model),
+		ParentMessageID: api.NewUUID(),
+		AutoContinue:    true,
+	}
+}
+
+// convertRole maps the OpenAI roles to the authors which the backend accepts, the system prompt is sent as system content,
+// the other roles (tool, function, etc.) are sent as user content
+func convertRole(role string) string {
+	switch role {
+	case roleSystem, roleDeveloper:
+		return roleSystem
+	case roleAssistant:
+		return roleAssistant
+	default:
+		return defaultRole
+	}
+}
+
+// convertModel maps the OpenAI model names to the ChatGPT model slugs, unknown names are treated as slugs
+func convertModel(model string) string {
+	if strings.HasPrefix(model, gpt4Model) {
+		return gpt4Model
+	}
+
+	if model == "" || strings.HasPrefix(model, "gpt-3.5") {
+		return gpt35Model
+	}
+
+	return model
+}
+
+func convertFinishReason(finishType string) string {
+	if finishType == responseTypeMaxTokens {
+		return finishReasonLength
+	}
+
+	return finishReasonStop
+}
+
+func isAssistantTextMessage(response *CreateConversationResponse) bool {
+	message := response.Message
+	return message.Author.Role == roleAssistant &&
+		message.Content.ContentType == contentTypeText &&
+		(message.Recipient == "" || message.Recipient == recipientAll) &&
+		len(message.Content.Parts) != 0
+}
+
+//goland:noinspection GoUnhandledErrorResult
+func writeChatCompletionsChunk(c *gin.Context, id string, created int64, model string, delta platform.ChatCompletionsDelta, finishReason *string) {
+	jsonBytes, _ := json.Marshal(platform.ChatCompletionsResponse{
+		ID:      id,
+		Object:  chatCompletionChunkObject,
+		Created: created,
+		Model:   model,
+		Choices: []platform.ChatCompletionsChoice{{
+			Delta:        &delta,
+			FinishReason: finishReason,
+		}},
+	})
+	c.Writer.Write([]byte("data: " + string(jsonBytes) + "\n\n"))
+	c.Writer.Flush()
+}
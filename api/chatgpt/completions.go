@@ -0,0 +1,131 @@
+package chatgpt
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/linweiyuan/go-chatgpt-api/api"
+	"github.com/linweiyuan/go-chatgpt-api/api/platform"
+
+	http "github.com/bogdanfinn/fhttp"
+)
+
+// CreateCompletions serves the legacy OpenAI completions format with a single turn ChatGPT conversation
+//
+//goland:noinspection GoUnhandledErrorResult
+func CreateCompletions(c *gin.Context) {
+	var request CompletionsRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, api.ReturnMessage(parseJsonErrorMessage))
+		return
+	}
+
+	prompt, err := parseCompletionsPrompt(request.Prompt)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, api.ReturnMessage(err.Error()))
+		return
+	}
+
+	conversationRequest := convertChatCompletionsRequest(platform.ChatCompletionsRequest{
+		Model: request.Model,
+		Messages: []platform.ChatCompletionsMessage{{
+			Role:    defaultRole,
+			Content: prompt,
+		}},
+	})
+	if done := setArkoseToken(c, &conversationRequest); done {
+		return
+	}
+
+	resp, done := sendConversationRequest(c, conversationRequest)
+	if done {
+		return
+	}
+
+	id := completionsIDPrefix + api.NewUUID()
+	created := time.Now().Unix()
+	if request.Stream {
+		c.Writer.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	}
+
+	response := readAssistantTextResponse(c, resp, conversationRequest, func(delta string) {
+		if request.Stream {
+			writeCompletionsChunk(c, id, created, request.Model, delta, nil)
+		}
+	})
+
+	if c.IsAborted() {
+		return
+	}
+
+	finishReason := convertFinishReason(response.finishType)
+	if request.Stream {
+		writeCompletionsChunk(c, id, created, request.Model, "", &finishReason)
+		c.Writer.Write([]byte("data: " + streamDone + "\n\n"))
+		c.Writer.Flush()
+	} else {
+		c.JSON(http.StatusOK, platform.CompletionsResponse{
+			ID:      id,
+			Object:  textCompletionObject,
+			Created: created,
+			Model:   request.Model,
+			Choices: []platform.CompletionsChoice{{
+				Text:         response.text,
+				FinishReason: &finishReason,
+			}},
+			Usage: &platform.Usage{},
+		})
+	}
+
+	if request.HideConversation && response.conversationID != "" {
+		hideConversation(c, response.conversationID)
+	}
+}
+
+// parseCompletionsPrompt accepts the prompt as a string or an array of one string,
+// more prompts would be more conversations, which are not supported
+func parseCompletionsPrompt(data json.RawMessage) (string, error) {
+	var prompt string
+	if len(data) == 0 {
+		return "", errors.New(emptyPromptErrorMessage)
+	}
+
+	if err := json.Unmarshal(data, &prompt); err != nil {
+		var prompts []string
+		if err := json.Unmarshal(data, &prompts); err != nil {
+			return "", errors.New(parseJsonErrorMessage)
+		}
+
+		if len(prompts) > 1 {
+			return "", errors.New(multiplePromptsErrorMessage)
+		}
+
+		if len(prompts) == 1 {
+			prompt = prompts[0]
+		}
+	}
+
+	if prompt == "" {
+		return "", errors.New(emptyPromptErrorMessage)
+	}
+
+	return prompt, nil
+}
+
+//goland:noinspection GoUnhandledErrorResult
+func writeCompletionsChunk(c *gin.Context, id string, created int64, model string, text string, finishReason *string) {
+	jsonBytes, _ := json.Marshal(platform.CompletionsResponse{
+		ID:      id,
+		Object:  textCompletionObject,
+		Created: created,
+		Model:   model,
+		Choices: []platform.CompletionsChoice{{
+			Text:         text,
+			FinishReason: finishReason,
+		}},
+	})
+	c.Writer.Write([]byte("data: " + string(jsonBytes) + "\n\n"))
+	c.Writer.Flush()
+}
@@ -1,5 +1,7 @@
 package chatgpt
 
+import "time"
+
 //goland:noinspection SpellCheckingInspection
 const (
 	apiPrefix                      = "https://chat.openai.com/backend-api"
@@ -19,8 +21,107 @@ const (
 	getCsrfTokenErrorMessage = "Failed to get CSRF token."
 	authSessionUrl           = "https://chat.openai.com/api/auth/session"
 
+	sessionTokenCookieName          = "__Secure-next-auth.session-token"
+	emptySessionTokenErrorMessage   = "Session token must not be empty."
+	invalidSessionTokenErrorMessage = "Session token is invalid or expired."
+
+	arkoseProviderUrl            = "url"
+	arkoseProviderFile           = "file"
+	arkoseProviderTokens         = "tokens"
+	arkoseProviderCommand        = "command"
+	arkoseProviderFakeOpen       = "fakeopen"
+	defaultArkoseTimeout         = 10 * time.Second
+	fakeOpenArkoseParamsUrl      = "https://ai.fakeopen.com/api/arkose/params?format=all"
+	getArkoseTokenErrorMessage   = "Failed to get arkose token."
+	emptyArkoseTokenErrorMessage = "empty token"
+	noArkoseTokenErrorMessage    = "no token"
+	defaultArkoseTokenTTL        = 2 * time.Minute
+	arkosePoolCheckInterval      = 10 * time.Second
+	arkosePoolRetryInterval      = 5 * time.Second
+	arkoseCapability             = "arkose"
+	modelsCacheExpireTime        = time.Hour
+
+	loginStepUsername         = "username"
+	loginStepPassword         = "password"
+	loginStepChallengeCode    = "challenge_code"
+	loginStepAccessToken      = "access_token"
+	loginChallengeCaptcha     = "captcha"
+	loginChallengeOTP         = "otp"
+	loginChallengeEmail       = "email"
+	loginStatusPending        = "pending"
+	loginStatusDone           = "done"
+	loginFlowExpireTime       = 10 * time.Minute
+	loginNotFoundErrorMessage = "Login is not found or expired, start it again."
+	emptyAnswerErrorMessage   = "Answer of the challenge must not be empty."
+
 	gpt4Model                          = "gpt-4"
+	gpt35Model                         = "text-davinci-002-render-sha"
+	actionNext                         = "next"
 	actionContinue                     = "continue"
+	contentTypeText                    = "text"
+	roleAssistant                      = "assistant"
+	roleSystem                         = "system"
+	roleDeveloper                      = "developer"
+	recipientAll                       = "all"
 	responseTypeMaxTokens              = "max_tokens"
 	responseStatusFinishedSuccessfully = "finished_successfully"
+
+	chatCompletionsIDPrefix               = "chatcmpl-"
+	chatCompletionObject                  = "chat.completion"
+	chatCompletionChunkObject             = "chat.completion.chunk"
+	finishReasonStop                      = "stop"
+	finishReasonLength                    = "length"
+	emptyMessagesErrorMessage             = "Messages must not be empty."
+	emptyConversationResponseErrorMessage = "No message is returned in the conversation."
+	streamDone                            = "[DONE]"
+	completionsIDPrefix                   = "cmpl-"
+	textCompletionObject                  = "text_completion"
+	emptyPromptErrorMessage               = "Prompt must not be empty."
+	multiplePromptsErrorMessage           = "Only one prompt is supported."
+
+	exportFormatMarkdown            = "markdown"
+	exportFormatHTML                = "html"
+	exportFormatText                = "txt"
+	exportFormatJSON                = "json"
+	exportTimeLayout                = "2006-01-02 15:04:05"
+	invalidExportFormatErrorMessage = "Export format should be one of markdown, html, txt and json."
+
+	exportJobStatusRunning         = "running"
+	exportJobStatusReady           = "ready"
+	exportJobStatusStreaming       = "streaming"
+	exportJobStatusDone            = "done"
+	exportJobStatusFailed          = "failed"
+	exportPageLimit                = 50
+	exportConcurrency              = 4
+	exportJobExpireTime            = time.Hour
+	exportJobNotFoundErrorMessage  = "Export job is not found."
+	exportJobNotReadyErrorMessage  = "Export job is not ready, check the status of the job."
+	exportJobStreamingErrorMessage = "Export job is already being downloaded."
+
+	messageNotFoundErrorMessage = "Message is not found in the conversation."
+
+	ManagedSessionPrefix               = "managed-"
+	ManagedSessionContextKey           = "managedSession"
+	managedSessionRenewBefore          = 24 * time.Hour
+	managedSessionRenewInterval        = 10 * time.Minute
+	managedSessionRenewMaxBackoff      = 6 * time.Hour
+	managedSessionMaxAuthFailures      = 3
+	ManagedSessionNotFoundErrorMessage = "Session is not found."
+	parseAuthSessionErrorMessage       = "Failed to parse auth session."
+
+	sessionKeyHeader     = "X-Session-Key"
+	sessionExpireTime    = 24 * time.Hour
+	sessionSweepInterval = time.Hour
+
+	deltaTypeDelta  = "delta"
+	deltaTypeFinish = "finish"
+
+	accountStatusHealthy           = "healthy"
+	accountStatusExpired           = "expired"
+	accountStatusDeactivated       = "deactivated"
+	accountStatusCloudflareBlocked = "cloudflare_blocked"
+	accountStatusUnknown           = "unknown"
+	defaultAccountCheckInterval    = 10 * time.Minute
+	accountIDLength                = 12
+	accountCheckBodyLimit          = 64 * 1024
 )
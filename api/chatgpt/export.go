@@ -0,0 +1,242 @@
+package chatgpt
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/linweiyuan/go-chatgpt-api/api"
+
+	http "github.com/bogdanfinn/fhttp"
+)
+
+// ExportConversation renders the active branch (from current_node back to the root) of the conversation
+//
+//goland:noinspection GoUnhandledErrorResult
+func ExportConversation(c *gin.Context) {
+	format := c.DefaultQuery("format", exportFormatMarkdown)
+	if format != exportFormatMarkdown && format != exportFormatHTML && format != exportFormatText && format != exportFormatJSON {
+		c.AbortWithStatusJSON(http.StatusBadRequest, api.ReturnMessage(invalidExportFormatErrorMessage))
+		return
+	}
+
+	conversation, statusCode, err := fetchConversation(c.Request.Context(), c.GetHeader(api.AuthorizationHeader), c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(statusCode, api.ReturnMessage(err.Error()))
+		return
+	}
+
+	export := newConversationExport(c.Param("id"), conversation)
+	switch format {
+	case exportFormatJSON:
+		c.JSON(http.StatusOK, export)
+	case exportFormatHTML:
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		c.Writer.WriteString(renderHTML(export))
+	case exportFormatText:
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+		c.Writer.WriteString(renderText(export))
+	default:
+		c.Header("Content-Type", "text/markdown; charset=utf-8")
+		c.Writer.WriteString(renderMarkdown(export))
+	}
+}
+
+// activePath returns the nodes from the root to current_node
+func (conversation *GetConversationResponse) activePath() []ConversationNode {
+	return conversation.pathTo(conversation.CurrentNode)
+}
+
+// pathTo returns the nodes from the root to the node, nil if the node is not found
+func (conversation *GetConversationResponse) pathTo(nodeID string) []ConversationNode {
+	var path []ConversationNode
+	for nodeID != "" {
+		node, ok := conversation.Mapping[nodeID]
+		if !ok {
+			break
+		}
+
+		path = append([]ConversationNode{node}, path...)
+		if node.Parent == nil {
+			break
+		}
+		nodeID = *node.Parent
+	}
+
+	return path
+}
+
+func (message *ConversationMessage) text() string {
+	if message.Content.Text != "" {
+		return message.Content.Text
+	}
+
+	parts := make([]string, 0, len(message.Content.Parts))
+	for _, part := range message.Content.Parts {
+		if text, ok := part.(string); ok {
+			parts = append(parts, text)
+		} else {
+			parts = append(parts, "[attachment]")
+		}
+	}
+
+	return strings.Join(parts, "\n")
+}
+
+// newConversationExport linearizes the active branch, the hidden system message and empty messages are skipped
+func newConversationExport(conversationID string, conversation *GetConversationResponse) ConversationExport {
+	export := ConversationExport{
+		ID:         conversationID,
+		Title:      conversation.Title,
+		CreateTime: unixTime(conversation.CreateTime),
+		UpdateTime: unixTime(conversation.UpdateTime),
+		Messages:   []ExportMessage{},
+	}
+
+	for _, node := range conversation.activePath() {
+		message := node.Message
+		if message == nil {
+			continue
+		}
+
+		text := message.text()
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		exportMessage := ExportMessage{
+			ID:          message.ID,
+			Role:        message.Author.Role,
+			ContentType: message.Content.ContentType,
+			Text:        text,
+		}
+		if message.CreateTime != nil {
+			createTime := unixTime(*message.CreateTime)
+			exportMessage.CreateTime = &createTime
+		}
+		export.Messages = append(export.Messages, exportMessage)
+	}
+
+	return export
+}
+
+func unixTime(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+func roleName(role string) string {
+	switch role {
+	case defaultRole:
+		return "User"
+	case roleAssistant:
+		return "ChatGPT"
+	case "system":
+		return "System"
+	case "tool":
+		return "Tool"
+	default:
+		return role
+	}
+}
+
+// messageMarkdown wraps code and execution output into code blocks, the text messages are markdown already
+func messageMarkdown(message ExportMessage) string {
+	if message.ContentType == contentTypeText || message.ContentType == "" {
+		return message.Text
+	}
+
+	return "```\n" + message.Text + "\n```"
+}
+
+func messageHeading(message ExportMessage) string {
+	if message.CreateTime == nil {
+		return roleName(message.Role)
+	}
+
+	return fmt.Sprintf("%s (%s)", roleName(message.Role), message.CreateTime.Format(exportTimeLayout))
+}
+
+func renderMarkdown(export ConversationExport) string {
+	var builder strings.Builder
+	builder.WriteString("# " + export.Title + "\n\n")
+	builder.WriteString("_" + export.CreateTime.Format(exportTimeLayout) + "_\n")
+	for _, message := range export.Messages {
+		builder.WriteString("\n## " + messageHeading(message) + "\n\n")
+		builder.WriteString(messageMarkdown(message) + "\n")
+	}
+
+	return builder.String()
+}
+
+func renderText(export ConversationExport) string {
+	var builder strings.Builder
+	builder.WriteString(export.Title + "\n")
+	builder.WriteString(export.CreateTime.Format(exportTimeLayout) + "\n")
+	for _, message := range export.Messages {
+		builder.WriteString("\n" + messageHeading(message) + ":\n")
+		builder.WriteString(message.Text + "\n")
+	}
+
+	return builder.String()
+}
+
+func renderHTML(export ConversationExport) string {
+	var builder strings.Builder
+	builder.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	builder.WriteString("<title>" + html.EscapeString(export.Title) + "</title>\n</head>\n<body>\n")
+	builder.WriteString("<h1>" + html.EscapeString(export.Title) + "</h1>\n")
+	builder.WriteString("<p><em>" + export.CreateTime.Format(exportTimeLayout) + "</em></p>\n")
+	for _, message := range export.Messages {
+		builder.WriteString("<h2>" + html.EscapeString(messageHeading(message)) + "</h2>\n")
+		builder.WriteString(markdownToHTML(messageMarkdown(message)))
+	}
+	builder.WriteString("</body>\n</html>\n")
+
+	return builder.String()
+}
+
+// markdownToHTML only handles the code blocks, the other lines are escaped and kept as paragraphs
+func markdownToHTML(markdown string) string {
+	var builder strings.Builder
+	inCodeBlock := false
+	var paragraph []string
+	flushParagraph := func() {
+		if len(paragraph) != 0 {
+			builder.WriteString("<p>" + strings.Join(paragraph, "<br>\n") + "</p>\n")
+			paragraph = nil
+		}
+	}
+
+	for _, line := range strings.Split(markdown, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			if inCodeBlock {
+				builder.WriteString("</code></pre>\n")
+			} else {
+				flushParagraph()
+				builder.WriteString("<pre><code>")
+			}
+			inCodeBlock = !inCodeBlock
+			continue
+		}
+
+		if inCodeBlock {
+			builder.WriteString(html.EscapeString(line) + "\n")
+			continue
+		}
+
+		if strings.TrimSpace(line) == "" {
+			flushParagraph()
+			continue
+		}
+		paragraph = append(paragraph, html.EscapeString(line))
+	}
+
+	if inCodeBlock {
+		builder.WriteString("</code></pre>\n")
+	}
+	flushParagraph()
+
+	return builder.String()
+}
@@ -1,10 +1,18 @@
 package chatgpt
 
 import (
+	"bytes"
+	"encoding/json"
+	"io"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/gin-gonic/gin"
 	"github.com/linweiyuan/go-chatgpt-api/api"
 	"github.com/linweiyuan/go-chatgpt-api/util/logger"
 
@@ -19,6 +27,18 @@ const (
 	sleepHours     = 8760 // 365 days
 )
 
+// after the startup probe, the registered access tokens (token pools and managed sessions) are checked periodically,
+// a status change is logged and posted to the webhook if set, only one check (of the monitor or refresh=true) runs at a time
+var (
+	accountCheckInterval      = defaultAccountCheckInterval
+	accountWebhookUrl         string
+	accountsHealth            = make(map[string]*AccountHealth)
+	accountsHealthMutex       sync.Mutex
+	lastAccountCheckTime      *time.Time
+	accountsCheckMutex        sync.Mutex
+	lastAccountCheckStartTime time.Time
+)
+
 //goland:noinspection GoUnhandledErrorResult,SpellCheckingInspection
 func init() {
 	proxyUrl := os.Getenv("GO_CHATGPT_API_PROXY")
@@ -46,6 +66,12 @@ func init() {
 
 		checkHealthCheckStatus(resp)
 	}
+
+	if interval, err := time.ParseDuration(os.Getenv("GO_CHATGPT_API_ACCOUNT_CHECK_INTERVAL")); err == nil && interval > 0 {
+		accountCheckInterval = interval
+	}
+	accountWebhookUrl = os.Getenv("GO_CHATGPT_API_ACCOUNT_WEBHOOK")
+	go monitorAccounts()
 }
 
 func healthCheck() (resp *http.Response, err error) {
@@ -72,3 +98,184 @@ func checkHealthCheckStatus(resp *http.Response) {
 		os.Exit(1)
 	}
 }
+
+// GetAccountsHealth returns the latest status of the registered accounts, refresh=true checks them right now
+func GetAccountsHealth(c *gin.Context) {
+	if c.Query("refresh") == "true" {
+		checkAccounts()
+	}
+
+	accountsHealthMutex.Lock()
+	items := make([]AccountHealth, 0, len(accountsHealth))
+	for _, health := range accountsHealth {
+		items = append(items, *health)
+	}
+	checkTime := lastAccountCheckTime
+	accountsHealthMutex.Unlock()
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Email < items[j].Email
+	})
+	c.JSON(http.StatusOK, AccountsHealthResponse{
+		Items:     items,
+		Total:     len(items),
+		Interval:  accountCheckInterval.String(),
+		CheckTime: checkTime,
+	})
+}
+
+func monitorAccounts() {
+	for {
+		time.Sleep(accountCheckInterval)
+
+		checkAccounts()
+	}
+}
+
+// checkAccounts skips the check if another one is started after it is called, which has the latest status already
+func checkAccounts() {
+	callTime := time.Now()
+	accountsCheckMutex.Lock()
+	defer accountsCheckMutex.Unlock()
+
+	if lastAccountCheckStartTime.After(callTime) {
+		return
+	}
+
+	lastAccountCheckStartTime = time.Now()
+	accessTokens := api.RegisteredAccessTokens()
+	managedSessionsMutex.Lock()
+	for _, session := range managedSessions {
+		accessTokens = append(accessTokens, session.accessToken)
+	}
+	managedSessionsMutex.Unlock()
+
+	checked := make(map[string]bool)
+	for _, accessToken := range accessTokens {
+		id := api.HashKey(accessToken)[:accountIDLength]
+		if checked[id] {
+			continue
+		}
+		checked[id] = true
+
+		health := checkAccount(accessToken)
+		health.ID = id
+		updateAccountHealth(health)
+	}
+
+	accountsHealthMutex.Lock()
+	defer accountsHealthMutex.Unlock()
+
+	// the tokens which are no longer registered (e.g. revoked or renewed) are dropped
+	for id := range accountsHealth {
+		if !checked[id] {
+			delete(accountsHealth, id)
+		}
+	}
+	now := time.Now()
+	lastAccountCheckTime = &now
+}
+
+// checkAccount calls the account check API with the access token, an expired JWT is not sent at all
+//
+//goland:noinspection GoUnhandledErrorResult
+func checkAccount(accessToken string) AccountHealth {
+	health := AccountHealth{
+		CheckTime: time.Now(),
+	}
+
+	if claims, err := api.ParseAccessToken(accessToken); err == nil {
+		health.Email = claims.Email
+		expiresAt := claims.ExpiresAt
+		health.ExpiresAt = &expiresAt
+		if claims.Expired {
+			health.Status = accountStatusExpired
+			return health
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, healthCheckUrl, nil)
+	req.Header.Set("User-Agent", api.UserAgent)
+	resp, err := api.DoWithAccessToken(req, accessToken, "")
+	if err != nil {
+		health.Status = accountStatusUnknown
+		health.Message = err.Error()
+		return health
+	}
+
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, accountCheckBodyLimit))
+	body := strings.ToLower(string(data))
+	health.StatusCode = resp.StatusCode
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		health.Status = accountStatusHealthy
+	case strings.Contains(body, accountStatusDeactivated):
+		health.Status = accountStatusDeactivated
+	case resp.StatusCode == http.StatusUnauthorized:
+		health.Status = accountStatusExpired
+	case resp.StatusCode == http.StatusForbidden && strings.Contains(resp.Header.Get("Content-Type"), "text/html"):
+		// the backend API only returns JSON, an HTML page is the challenge of Cloudflare
+		health.Status = accountStatusCloudflareBlocked
+	default:
+		health.Status = accountStatusUnknown
+		health.Message = http.StatusText(resp.StatusCode)
+	}
+
+	return health
+}
+
+func updateAccountHealth(health AccountHealth) {
+	accountsHealthMutex.Lock()
+	previousStatus := ""
+	health.ChangeTime = health.CheckTime
+	if previous, ok := accountsHealth[health.ID]; ok {
+		previousStatus = previous.Status
+		if previous.Status == health.Status {
+			health.ChangeTime = previous.ChangeTime
+		}
+	}
+	accountsHealth[health.ID] = &health
+	accountsHealthMutex.Unlock()
+
+	// a new account is only reported if it is not healthy
+	if health.Status == previousStatus || (previousStatus == "" && health.Status == accountStatusHealthy) {
+		return
+	}
+
+	message := "Account " + health.ID + " (" + health.Email + ") is " + health.Status
+	if previousStatus != "" {
+		message += ", it was " + previousStatus
+	}
+	if health.Status == accountStatusHealthy {
+		logger.Info(message)
+	} else {
+		logger.Error(message)
+	}
+
+	notifyAccountStatusChange(AccountStatusChangeEvent{
+		AccountHealth:  health,
+		PreviousStatus: previousStatus,
+	})
+}
+
+//goland:noinspection GoUnhandledErrorResult
+func notifyAccountStatusChange(event AccountStatusChangeEvent) {
+	if accountWebhookUrl == "" {
+		return
+	}
+
+	data, _ := json.Marshal(event)
+	req, _ := http.NewRequest(http.MethodPost, accountWebhookUrl, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := api.Client.Do(req)
+	if err != nil {
+		logger.Error("Failed to notify account status change: " + err.Error())
+		return
+	}
+
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		logger.Error("Failed to notify account status change, status code: " + strconv.Itoa(resp.StatusCode))
+	}
+}
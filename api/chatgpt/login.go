@@ -2,6 +2,8 @@ package chatgpt
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
@@ -19,17 +21,59 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	authSession, statusCode, err := login(loginInfo)
+	if err != nil {
+		c.AbortWithStatusJSON(statusCode, api.ReturnMessage(err.Error()))
+		return
+	}
+
+	c.Writer.WriteString(authSession)
+}
+
+// login runs the whole Auth0 flow and returns the auth session json which contains the access token
+//
+//goland:noinspection GoUnhandledErrorResult,GoErrorStringFormat
+func login(loginInfo api.LoginInfo) (string, int, error) {
 	userLogin := UserLogin{
 		client: api.NewHttpClient(),
 	}
 
+	state, statusCode, err := userLogin.getLoginState()
+	if err != nil {
+		return "", statusCode, err
+	}
+
+	// check username
+	statusCode, err = userLogin.CheckUsername(state, loginInfo.Username)
+	if err != nil {
+		return "", statusCode, err
+	}
+
+	// check password (and OTP if two-factor authentication is enabled)
+	_, statusCode, err = api.CheckPasswordWithOTP(&userLogin, state, loginInfo)
+	if err != nil {
+		return "", statusCode, err
+	}
+
+	// get access token
+	accessToken, statusCode, err := userLogin.GetAccessToken("")
+	if err != nil {
+		return "", statusCode, err
+	}
+
+	return accessToken, http.StatusOK, nil
+}
+
+// getLoginState gets the CSRF token and the authorized url, then returns the state of the Auth0 login page
+//
+//goland:noinspection GoUnhandledErrorResult
+func (userLogin *UserLogin) getLoginState() (string, int, error) {
 	// get csrf token
 	req, _ := http.NewRequest(http.MethodGet, csrfUrl, nil)
 	req.Header.Set("User-Agent", api.UserAgent)
 	resp, err := userLogin.client.Do(req)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(err.Error()))
-		return
+		return "", api.ErrorStatusCode(err), err
 	}
 
 	defer resp.Body.Close()
@@ -38,13 +82,11 @@ func Login(c *gin.Context) {
 			doc, _ := goquery.NewDocumentFromReader(resp.Body)
 			alert := doc.Find(".message").Text()
 			if alert != "" {
-				c.AbortWithStatusJSON(resp.StatusCode, api.ReturnMessage(strings.TrimSpace(alert)))
-				return
+				return "", resp.StatusCode, errors.New(strings.TrimSpace(alert))
 			}
 		}
 
-		c.AbortWithStatusJSON(resp.StatusCode, api.ReturnMessage(getCsrfTokenErrorMessage))
-		return
+		return "", resp.StatusCode, errors.New(getCsrfTokenErrorMessage)
 	}
 
 	// get authorized url
@@ -52,37 +94,66 @@ func Login(c *gin.Context) {
 	json.NewDecoder(resp.Body).Decode(&responseMap)
 	authorizedUrl, statusCode, err := userLogin.GetAuthorizedUrl(responseMap["csrfToken"])
 	if err != nil {
-		c.AbortWithStatusJSON(statusCode, api.ReturnMessage(err.Error()))
-		return
+		return "", statusCode, err
 	}
 
 	// get state
-	state, statusCode, err := userLogin.GetState(authorizedUrl)
-	if err != nil {
-		c.AbortWithStatusJSON(statusCode, api.ReturnMessage(err.Error()))
+	return userLogin.GetState(authorizedUrl)
+}
+
+// LoginWithSessionToken exchanges the session token cookie (e.g. of an SSO login) for the access token,
+// the session token is rotated by ChatGPT, so the returned one should be used next time
+func LoginWithSessionToken(c *gin.Context) {
+	var request SessionTokenLoginRequest
+	if err := c.ShouldBindJSON(&request); err != nil || strings.TrimSpace(request.SessionToken) == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, api.ReturnMessage(emptySessionTokenErrorMessage))
 		return
 	}
 
-	// check username
-	statusCode, err = userLogin.CheckUsername(state, loginInfo.Username)
+	response, statusCode, err := loginWithSessionToken(strings.TrimSpace(request.SessionToken))
 	if err != nil {
 		c.AbortWithStatusJSON(statusCode, api.ReturnMessage(err.Error()))
 		return
 	}
 
-	// check password
-	_, statusCode, err = userLogin.CheckPassword(state, loginInfo.Username, loginInfo.Password)
+	c.JSON(http.StatusOK, response)
+}
+
+//goland:noinspection GoUnhandledErrorResult
+func loginWithSessionToken(sessionToken string) (*SessionTokenLoginResponse, int, error) {
+	client := api.NewHttpClient()
+	req, _ := http.NewRequest(http.MethodGet, authSessionUrl, nil)
+	req.Header.Set("User-Agent", api.UserAgent)
+	req.AddCookie(&http.Cookie{
+		Name:  sessionTokenCookieName,
+		Value: sessionToken,
+	})
+	resp, err := client.Do(req)
 	if err != nil {
-		c.AbortWithStatusJSON(statusCode, api.ReturnMessage(err.Error()))
-		return
+		return nil, api.ErrorStatusCode(err), err
 	}
 
-	// get access token
-	accessToken, statusCode, err := userLogin.GetAccessToken("")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode, errors.New(api.GetAccessTokenErrorMessage)
+	}
+
+	// an invalid or expired session token gets an empty session
+	data, _ := io.ReadAll(resp.Body)
+	accessToken, expires, err := parseAuthSession(string(data))
 	if err != nil {
-		c.AbortWithStatusJSON(statusCode, api.ReturnMessage(err.Error()))
-		return
+		return nil, http.StatusUnauthorized, errors.New(invalidSessionTokenErrorMessage)
+	}
+
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == sessionTokenCookieName && cookie.Value != "" {
+			sessionToken = cookie.Value
+		}
 	}
 
-	c.Writer.WriteString(accessToken)
+	return &SessionTokenLoginResponse{
+		AccessToken:  accessToken,
+		Expires:      expires,
+		SessionToken: sessionToken,
+	}, http.StatusOK, nil
 }
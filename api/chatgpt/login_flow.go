@@ -0,0 +1,206 @@
+package chatgpt
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/linweiyuan/go-chatgpt-api/api"
+
+	http "github.com/bogdanfinn/fhttp"
+)
+
+// the resumable login keeps the Auth0 client (and its cookies) under a login ID,
+// the flow stops at an interactive challenge and goes on when the answer is sent to the continue API
+var (
+	pendingLogins      = make(map[string]*pendingLogin)
+	pendingLoginsMutex sync.Mutex
+	lastLoginSweepTime = time.Now()
+	challengeCodePaths = map[string]string{
+		loginChallengeOTP:   api.LoginMfaOtpChallengePath,
+		loginChallengeEmail: api.LoginMfaEmailChallengePath,
+	}
+)
+
+// StartLogin starts the Auth0 flow, the response is either the auth session or the pending challenge
+func StartLogin(c *gin.Context) {
+	var loginInfo api.LoginInfo
+	if err := c.ShouldBindJSON(&loginInfo); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, api.ReturnMessage(api.ParseUserInfoErrorMessage))
+		return
+	}
+
+	login := &pendingLogin{
+		id:        api.NewUUID(),
+		loginInfo: loginInfo,
+		userLogin: &UserLogin{
+			client: api.NewHttpClient(),
+		},
+		step:    loginStepUsername,
+		expires: time.Now().Add(loginFlowExpireTime),
+	}
+
+	state, statusCode, err := login.userLogin.getLoginState()
+	if err != nil {
+		c.AbortWithStatusJSON(statusCode, api.ReturnMessage(err.Error()))
+		return
+	}
+
+	login.state = state
+	if login.userLogin.captchaImage != "" {
+		login.challenge = loginChallengeCaptcha
+		savePendingLogin(login)
+		c.JSON(http.StatusOK, login.response())
+		return
+	}
+
+	runPendingLogin(c, login, "")
+}
+
+// ContinueLogin answers the pending challenge of the login
+func ContinueLogin(c *gin.Context) {
+	var request ContinueLoginRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, api.ReturnMessage(parseJsonErrorMessage))
+		return
+	}
+
+	// taken out of the map, so that the same login is not continued twice at the same time
+	pendingLoginsMutex.Lock()
+	login, ok := pendingLogins[request.LoginID]
+	delete(pendingLogins, request.LoginID)
+	pendingLoginsMutex.Unlock()
+
+	if !ok || time.Now().After(login.expires) {
+		c.AbortWithStatusJSON(http.StatusNotFound, api.ReturnMessage(loginNotFoundErrorMessage))
+		return
+	}
+
+	if request.Answer == "" {
+		savePendingLogin(login)
+		c.AbortWithStatusJSON(http.StatusBadRequest, api.ReturnMessage(emptyAnswerErrorMessage))
+		return
+	}
+
+	runPendingLogin(c, login, request.Answer)
+}
+
+func runPendingLogin(c *gin.Context, login *pendingLogin, answer string) {
+	authSession, statusCode, err := login.run(answer)
+	if err != nil {
+		// a wrong code can be sent again, other errors end the login
+		if login.challenge == loginChallengeOTP || login.challenge == loginChallengeEmail {
+			savePendingLogin(login)
+		}
+
+		c.AbortWithStatusJSON(statusCode, api.ReturnMessage(err.Error()))
+		return
+	}
+
+	if authSession == "" {
+		savePendingLogin(login)
+		c.JSON(http.StatusOK, login.response())
+		return
+	}
+
+	c.JSON(http.StatusOK, LoginFlowResponse{
+		Status:      loginStatusDone,
+		AuthSession: json.RawMessage(authSession),
+	})
+}
+
+// run goes on from the current step with the answer of the pending challenge,
+// the auth session is empty if the login stops at a challenge again
+func (login *pendingLogin) run(answer string) (string, int, error) {
+	userLogin := login.userLogin
+	if login.step == loginStepUsername {
+		if login.challenge == loginChallengeCaptcha {
+			userLogin.captcha = answer
+			login.challenge = ""
+			answer = ""
+		}
+
+		statusCode, err := userLogin.CheckUsername(login.state, login.loginInfo.Username)
+		if err != nil {
+			return "", statusCode, err
+		}
+
+		login.step = loginStepPassword
+	}
+
+	if login.step == loginStepPassword {
+		challengeState, statusCode, err := userLogin.CheckPassword(login.state, login.loginInfo.Username, login.loginInfo.Password)
+		switch {
+		case errors.Is(err, api.ErrOTPRequired):
+			login.challenge = loginChallengeOTP
+		case errors.Is(err, api.ErrEmailCodeRequired):
+			login.challenge = loginChallengeEmail
+		case err != nil:
+			return "", statusCode, err
+		}
+
+		login.step = loginStepAccessToken
+		if login.challenge != "" {
+			login.step = loginStepChallengeCode
+			if challengeState != "" {
+				login.state = challengeState
+			}
+
+			// no need to wait if the OTP is already known
+			if otp, err := login.loginInfo.OneTimePassword(); err == nil && login.challenge == loginChallengeOTP {
+				answer = otp
+			}
+		}
+	}
+
+	if login.step == loginStepChallengeCode {
+		if answer == "" {
+			return "", http.StatusOK, nil
+		}
+
+		_, statusCode, err := userLogin.checkChallengeCode(challengeCodePaths[login.challenge], login.state, answer)
+		if err != nil {
+			return "", statusCode, err
+		}
+
+		login.challenge = ""
+		login.step = loginStepAccessToken
+	}
+
+	return userLogin.GetAccessToken("")
+}
+
+func (login *pendingLogin) response() LoginFlowResponse {
+	response := LoginFlowResponse{
+		LoginID:   login.id,
+		Status:    loginStatusPending,
+		Challenge: login.challenge,
+		ExpiresAt: &login.expires,
+	}
+	if login.challenge == loginChallengeCaptcha {
+		response.CaptchaImage = login.userLogin.captchaImage
+	}
+
+	return response
+}
+
+func savePendingLogin(login *pendingLogin) {
+	pendingLoginsMutex.Lock()
+	defer pendingLoginsMutex.Unlock()
+
+	now := time.Now()
+	pendingLogins[login.id] = login
+
+	if now.Sub(lastLoginSweepTime) < loginFlowExpireTime {
+		return
+	}
+
+	for id, login := range pendingLogins {
+		if now.After(login.expires) {
+			delete(pendingLogins, id)
+		}
+	}
+	lastLoginSweepTime = now
+}
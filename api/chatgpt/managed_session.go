@@ -0,0 +1,303 @@
+package chatgpt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/linweiyuan/go-chatgpt-api/api"
+	"github.com/linweiyuan/go-chatgpt-api/util/logger"
+
+	http "github.com/bogdanfinn/fhttp"
+)
+
+// managed sessions keep the (encrypted) credentials and renew the access token before it expires,
+// callers use the session ID as a stable handle instead of the access token
+var (
+	managedSessions      = make(map[string]*managedSession)
+	managedSessionsMutex sync.Mutex
+	managedSessionsOnce  sync.Once
+	credentialsKey       []byte
+)
+
+//goland:noinspection SpellCheckingInspection
+func init() {
+	secret := os.Getenv("GO_CHATGPT_API_SESSION_SECRET")
+	if secret == "" {
+		logger.Error("GO_CHATGPT_API_SESSION_SECRET is not set, the credentials of the managed sessions are encrypted with a random key, which is lost on restart.")
+		credentialsKey = make([]byte, 32)
+		rand.Read(credentialsKey)
+		return
+	}
+
+	hash := sha256.Sum256([]byte(secret))
+	credentialsKey = hash[:]
+}
+
+// CreateManagedSession logs in and returns the session handle, the existing session is reused for the same credentials
+func CreateManagedSession(c *gin.Context) {
+	var loginInfo api.LoginInfo
+	if err := c.ShouldBindJSON(&loginInfo); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, api.ReturnMessage(api.ParseUserInfoErrorMessage))
+		return
+	}
+
+	fingerprint := credentialsFingerprint(loginInfo)
+	managedSessionsMutex.Lock()
+	for _, session := range managedSessions {
+		if session.fingerprint == fingerprint && time.Now().Before(session.expires) && !session.renewStopped {
+			response := session.response()
+			managedSessionsMutex.Unlock()
+			c.JSON(http.StatusOK, response)
+			return
+		}
+	}
+	managedSessionsMutex.Unlock()
+
+	authSession, statusCode, err := login(loginInfo)
+	if err != nil {
+		c.AbortWithStatusJSON(statusCode, api.ReturnMessage(err.Error()))
+		return
+	}
+
+	accessToken, expires, err := parseAuthSession(authSession)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(err.Error()))
+		return
+	}
+
+	credentials, err := encryptCredentials(loginInfo)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(err.Error()))
+		return
+	}
+
+	randomBytes := make([]byte, 24)
+	rand.Read(randomBytes)
+	session := &managedSession{
+		id:          ManagedSessionPrefix + hex.EncodeToString(randomBytes),
+		fingerprint: fingerprint,
+		credentials: credentials,
+		accessToken: accessToken,
+		expires:     expires,
+	}
+
+	managedSessionsMutex.Lock()
+	managedSessions[session.id] = session
+	response := session.response()
+	managedSessionsMutex.Unlock()
+
+	managedSessionsOnce.Do(func() {
+		go renewManagedSessions()
+	})
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetManagedSession returns the session of the handle in Authorization, the handle is not put in the path which is logged
+func GetManagedSession(c *gin.Context) {
+	managedSessionsMutex.Lock()
+	session, ok := managedSessions[c.GetString(ManagedSessionContextKey)]
+	var response ManagedSessionResponse
+	if ok {
+		response = session.response()
+	}
+	managedSessionsMutex.Unlock()
+
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, api.ReturnMessage(ManagedSessionNotFoundErrorMessage))
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func DeleteManagedSession(c *gin.Context) {
+	sessionID := c.GetString(ManagedSessionContextKey)
+	managedSessionsMutex.Lock()
+	_, ok := managedSessions[sessionID]
+	delete(managedSessions, sessionID)
+	managedSessionsMutex.Unlock()
+
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, api.ReturnMessage(ManagedSessionNotFoundErrorMessage))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetManagedSessionAccessToken returns the current access token of the session handle
+func GetManagedSessionAccessToken(sessionID string) (string, bool) {
+	managedSessionsMutex.Lock()
+	defer managedSessionsMutex.Unlock()
+
+	session, ok := managedSessions[sessionID]
+	if !ok {
+		return "", false
+	}
+
+	return session.accessToken, true
+}
+
+func (session *managedSession) response() ManagedSessionResponse {
+	return ManagedSessionResponse{
+		SessionID:    session.id,
+		Expires:      session.expires,
+		RenewError:   session.renewError,
+		RenewStopped: session.renewStopped,
+	}
+}
+
+// renewManagedSessions logs in again with the stored credentials when the access token is about to expire,
+// a failed renewal is tried again with exponential backoff, and given up after repeated auth errors
+func renewManagedSessions() {
+	for {
+		time.Sleep(managedSessionRenewInterval)
+
+		managedSessionsMutex.Lock()
+		now := time.Now()
+		var sessions []*managedSession
+		for _, session := range managedSessions {
+			if session.expires.Sub(now) < managedSessionRenewBefore && !session.renewStopped && !now.Before(session.nextRenewTime) {
+				sessions = append(sessions, session)
+			}
+		}
+		managedSessionsMutex.Unlock()
+
+		for _, session := range sessions {
+			renewManagedSession(session)
+		}
+	}
+}
+
+func renewManagedSession(session *managedSession) {
+	statusCode := http.StatusInternalServerError
+	accessToken, expires, err := func() (string, time.Time, error) {
+		loginInfo, err := decryptCredentials(session.credentials)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+
+		var authSession string
+		authSession, statusCode, err = login(loginInfo)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+
+		return parseAuthSession(authSession)
+	}()
+
+	managedSessionsMutex.Lock()
+	defer managedSessionsMutex.Unlock()
+
+	if err != nil {
+		session.renewError = err.Error()
+		session.renewFailures++
+		logger.Error("Failed to renew session " + session.id + ": " + err.Error())
+
+		// the credentials are rejected (wrong password, MFA, etc.), trying again only makes Auth0 block the account
+		isAuthError := statusCode >= http.StatusBadRequest && statusCode < http.StatusInternalServerError && statusCode != http.StatusTooManyRequests
+		if isAuthError {
+			session.authFailures++
+		}
+		if session.authFailures >= managedSessionMaxAuthFailures {
+			session.renewStopped = true
+			logger.Error("Renewal of session " + session.id + " is stopped, create the session again.")
+			return
+		}
+
+		backoff := managedSessionRenewInterval << (session.renewFailures - 1)
+		if backoff <= 0 || backoff > managedSessionRenewMaxBackoff {
+			backoff = managedSessionRenewMaxBackoff
+		}
+		session.nextRenewTime = time.Now().Add(backoff)
+		return
+	}
+
+	session.accessToken = accessToken
+	session.expires = expires
+	session.renewError = ""
+	session.renewFailures = 0
+	session.authFailures = 0
+	session.nextRenewTime = time.Time{}
+	logger.Info("Session " + session.id + " is renewed.")
+}
+
+func parseAuthSession(authSession string) (string, time.Time, error) {
+	var response AuthSessionResponse
+	if err := json.Unmarshal([]byte(authSession), &response); err != nil || response.AccessToken == "" {
+		return "", time.Time{}, errors.New(parseAuthSessionErrorMessage)
+	}
+
+	// the expires of the auth session is the one of the cookie, the access token expires earlier
+	if claims, err := api.ParseAccessToken(response.AccessToken); err == nil && claims.ExpiresAt.Unix() != 0 {
+		return response.AccessToken, claims.ExpiresAt, nil
+	}
+
+	expires, err := time.Parse(time.RFC3339, response.Expires)
+	if err != nil {
+		return "", time.Time{}, errors.New(parseAuthSessionErrorMessage)
+	}
+
+	return response.AccessToken, expires, nil
+}
+
+func credentialsFingerprint(loginInfo api.LoginInfo) string {
+	hash := sha256.Sum256(append(credentialsKey, []byte(loginInfo.Username+"\x00"+loginInfo.Password)...))
+	return hex.EncodeToString(hash[:])
+}
+
+func encryptCredentials(loginInfo api.LoginInfo) ([]byte, error) {
+	plaintext, _ := json.Marshal(loginInfo)
+	gcm, err := newCredentialsCipher()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func decryptCredentials(credentials []byte) (api.LoginInfo, error) {
+	var loginInfo api.LoginInfo
+	gcm, err := newCredentialsCipher()
+	if err != nil {
+		return loginInfo, err
+	}
+
+	if len(credentials) < gcm.NonceSize() {
+		return loginInfo, errors.New(api.ParseUserInfoErrorMessage)
+	}
+
+	nonce, ciphertext := credentials[:gcm.NonceSize()], credentials[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return loginInfo, err
+	}
+
+	err = json.Unmarshal(plaintext, &loginInfo)
+	return loginInfo, err
+}
+
+func newCredentialsCipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(credentialsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
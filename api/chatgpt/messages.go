@@ -0,0 +1,59 @@
+package chatgpt
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/linweiyuan/go-chatgpt-api/api"
+	"github.com/linweiyuan/go-chatgpt-api/api/anthropic"
+	"github.com/linweiyuan/go-chatgpt-api/api/platform"
+
+	http "github.com/bogdanfinn/fhttp"
+)
+
+// CreateMessages serves the Anthropic messages format with the ChatGPT web backend
+//
+//goland:noinspection GoUnhandledErrorResult
+func CreateMessages(c *gin.Context) {
+	var request anthropic.MessagesRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, api.ReturnMessage(parseJsonErrorMessage))
+		return
+	}
+
+	if len(request.Messages) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, api.ReturnMessage(emptyMessagesErrorMessage))
+		return
+	}
+
+	conversationRequest := convertChatCompletionsRequest(platform.ConvertMessagesRequest(request))
+	if done := setArkoseToken(c, &conversationRequest); done {
+		return
+	}
+
+	resp, done := sendConversationRequest(c, conversationRequest)
+	if done {
+		return
+	}
+
+	id := anthropic.NewMessageID()
+	if request.Stream {
+		anthropic.WriteMessageStart(c, id, request.Model)
+	}
+
+	response := readAssistantTextResponse(c, resp, conversationRequest, func(delta string) {
+		if request.Stream {
+			anthropic.WriteTextDelta(c, delta)
+		}
+	})
+
+	if c.IsAborted() {
+		return
+	}
+
+	stopReason := anthropic.ConvertFinishReason(response.finishType)
+	if request.Stream {
+		anthropic.WriteMessageStop(c, stopReason, anthropic.Usage{})
+		return
+	}
+
+	c.JSON(http.StatusOK, anthropic.NewMessagesResponse(id, request.Model, response.text, stopReason, anthropic.Usage{}))
+}
@@ -0,0 +1,118 @@
+package chatgpt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/linweiyuan/go-chatgpt-api/api"
+	"github.com/linweiyuan/go-chatgpt-api/util/logger"
+)
+
+// the models of each account are cached to know which of them require an Arkose token, a pool key is resolved to its account first
+var (
+	accountModelsCache      = make(map[string]*accountModels)
+	accountModelsCacheMutex sync.Mutex
+	lastModelsSweepTime     = time.Now()
+)
+
+// requiresArkose tells if the model requires an Arkose token for the account which the conversation request is sent with,
+// it falls back to the model name only if the models can not be fetched
+func requiresArkose(ctx context.Context, authorization string, conversationID string, model string) bool {
+	accessToken, err := api.PeekAccessToken(authorization, conversationID)
+	if err != nil {
+		return strings.HasPrefix(model, gpt4Model)
+	}
+
+	models, err := getAccountModels(ctx, accessToken)
+	if err != nil {
+		logger.Error(getModelsErrorMessage + " " + err.Error())
+		return strings.HasPrefix(model, gpt4Model)
+	}
+
+	accountModelsCacheMutex.Lock()
+	defer accountModelsCacheMutex.Unlock()
+
+	return models.arkoseModels[model]
+}
+
+// markArkoseRequired remembers the model which is rejected without an Arkose token, so the later requests get one in advance,
+// the access token is the one of the account which rejects the request
+func markArkoseRequired(accessToken string, model string) {
+	accountModelsCacheMutex.Lock()
+	defer accountModelsCacheMutex.Unlock()
+
+	if models, ok := accountModelsCache[accountModelsKey(accessToken)]; ok {
+		models.arkoseModels[model] = true
+	}
+}
+
+func getAccountModels(ctx context.Context, accessToken string) (*accountModels, error) {
+	key := accountModelsKey(accessToken)
+	now := time.Now()
+
+	accountModelsCacheMutex.Lock()
+	sweepAccountModels(now)
+	models, ok := accountModelsCache[key]
+	accountModelsCacheMutex.Unlock()
+	if ok && now.Before(models.expires) {
+		return models, nil
+	}
+
+	data, _, err := fetchData(ctx, accessToken, "", apiPrefix+"/models", getModelsErrorMessage)
+	if err != nil {
+		return nil, err
+	}
+
+	var response GetModelsResponse
+	if err := json.Unmarshal(data, &response); err != nil || len(response.Models) == 0 {
+		return nil, errors.New(getModelsErrorMessage)
+	}
+
+	models = &accountModels{
+		arkoseModels: make(map[string]bool),
+		expires:      now.Add(modelsCacheExpireTime),
+	}
+	for _, model := range response.Models {
+		if modelRequiresArkose(model) {
+			models.arkoseModels[model.Slug] = true
+		}
+	}
+
+	accountModelsCacheMutex.Lock()
+	accountModelsCache[key] = models
+	accountModelsCacheMutex.Unlock()
+	return models, nil
+}
+
+// modelRequiresArkose reads the capabilities of the model, the models with the tools enabled (browsing, plugins, etc.) are the ones guarded by Arkose
+func modelRequiresArkose(model ModelInfo) bool {
+	for capability, enabled := range model.Capabilities {
+		if strings.Contains(capability, arkoseCapability) && enabled == true {
+			return true
+		}
+	}
+
+	return len(model.EnabledTools) != 0
+}
+
+// accountModelsKey ignores the "Bearer" prefix, as the pooled tokens may be configured with or without it
+func accountModelsKey(accessToken string) string {
+	return api.HashKey(api.GetAccessToken(accessToken))
+}
+
+func sweepAccountModels(now time.Time) {
+	if now.Sub(lastModelsSweepTime) < modelsCacheExpireTime {
+		return
+	}
+
+	for key, models := range accountModelsCache {
+		if !now.Before(models.expires) {
+			delete(accountModelsCache, key)
+		}
+	}
+	lastModelsSweepTime = now
+}
@@ -0,0 +1,68 @@
+package chatgpt
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/linweiyuan/go-chatgpt-api/api"
+	"github.com/linweiyuan/go-chatgpt-api/api/limiter"
+)
+
+// conversation sessions let clients without state hold a multi-turn chat,
+// the latest conversation and message IDs are recorded under the session key of each caller (the identity of the rate limiter),
+// which is not the current access token, so a renewed managed session or another token of the pool keeps the chat
+var (
+	conversationSessions      = make(map[string]conversationSession)
+	conversationSessionsMutex sync.Mutex
+	lastSessionSweepTime      = time.Now()
+)
+
+func conversationSessionKey(c *gin.Context, sessionKey string) string {
+	return c.GetString(limiter.ContextKey) + "|" + sessionKey
+}
+
+// loadConversationSession fills in the conversation ID and the parent message ID if the client does not send them
+func loadConversationSession(c *gin.Context, request *CreateConversationRequest) {
+	if request.ConversationID == nil && request.ParentMessageID == "" && c.GetString(limiter.ContextKey) != "" {
+		conversationSessionsMutex.Lock()
+		session, ok := conversationSessions[conversationSessionKey(c, request.sessionKey)]
+		conversationSessionsMutex.Unlock()
+
+		if ok && time.Since(session.updateTime) < sessionExpireTime {
+			request.ConversationID = &session.conversationID
+			request.ParentMessageID = session.parentMessageID
+		}
+	}
+
+	if request.ParentMessageID == "" {
+		request.ParentMessageID = api.NewUUID()
+	}
+}
+
+func saveConversationSession(c *gin.Context, sessionKey string, conversationID string, messageID string) {
+	if c.GetString(limiter.ContextKey) == "" {
+		return
+	}
+
+	conversationSessionsMutex.Lock()
+	defer conversationSessionsMutex.Unlock()
+
+	now := time.Now()
+	conversationSessions[conversationSessionKey(c, sessionKey)] = conversationSession{
+		conversationID:  conversationID,
+		parentMessageID: messageID,
+		updateTime:      now,
+	}
+
+	if now.Sub(lastSessionSweepTime) < sessionSweepInterval {
+		return
+	}
+
+	for key, session := range conversationSessions {
+		if now.Sub(session.updateTime) >= sessionExpireTime {
+			delete(conversationSessions, key)
+		}
+	}
+	lastSessionSweepTime = now
+}
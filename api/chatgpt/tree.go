@@ -0,0 +1,129 @@
+package chatgpt
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/linweiyuan/go-chatgpt-api/api"
+
+	http "github.com/bogdanfinn/fhttp"
+)
+
+// GetCurrentNode reports which node of the mapping tree is current
+func GetCurrentNode(c *gin.Context) {
+	conversation, done := getConversationTree(c)
+	if done {
+		return
+	}
+
+	node, ok := conversation.Mapping[conversation.CurrentNode]
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, api.ReturnMessage(messageNotFoundErrorMessage))
+		return
+	}
+
+	c.JSON(http.StatusOK, ConversationCurrentNodeResponse{
+		ConversationID: c.Param("id"),
+		CurrentNode:    conversation.nodeSummary(node, conversation.activePathIDs()),
+	})
+}
+
+// GetBranches lists the children of the message, edits and regenerations are siblings under the same parent
+func GetBranches(c *gin.Context) {
+	conversation, done := getConversationTree(c)
+	if done {
+		return
+	}
+
+	messageID := c.Param("message_id")
+	node, ok := conversation.Mapping[messageID]
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, api.ReturnMessage(messageNotFoundErrorMessage))
+		return
+	}
+
+	activePathIDs := conversation.activePathIDs()
+	branches := make([]ConversationNodeSummary, 0, len(node.Children))
+	for _, childID := range node.Children {
+		if child, ok := conversation.Mapping[childID]; ok {
+			branches = append(branches, conversation.nodeSummary(child, activePathIDs))
+		}
+	}
+
+	c.JSON(http.StatusOK, ConversationBranchesResponse{
+		ConversationID: c.Param("id"),
+		MessageID:      messageID,
+		CurrentNode:    conversation.CurrentNode,
+		Branches:       branches,
+	})
+}
+
+// GetPath returns the linear path from the root to the message
+func GetPath(c *gin.Context) {
+	conversation, done := getConversationTree(c)
+	if done {
+		return
+	}
+
+	messageID := c.Param("message_id")
+	path := conversation.pathTo(messageID)
+	if path == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, api.ReturnMessage(messageNotFoundErrorMessage))
+		return
+	}
+
+	activePathIDs := conversation.activePathIDs()
+	summaries := make([]ConversationNodeSummary, 0, len(path))
+	for _, node := range path {
+		summaries = append(summaries, conversation.nodeSummary(node, activePathIDs))
+	}
+
+	c.JSON(http.StatusOK, ConversationPathResponse{
+		ConversationID: c.Param("id"),
+		MessageID:      messageID,
+		CurrentNode:    conversation.CurrentNode,
+		Path:           summaries,
+	})
+}
+
+func getConversationTree(c *gin.Context) (*GetConversationResponse, bool) {
+	conversation, statusCode, err := fetchConversation(c.Request.Context(), c.GetHeader(api.AuthorizationHeader), c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(statusCode, api.ReturnMessage(err.Error()))
+		return nil, true
+	}
+
+	return conversation, false
+}
+
+func (conversation *GetConversationResponse) activePathIDs() map[string]bool {
+	ids := make(map[string]bool)
+	for _, node := range conversation.activePath() {
+		ids[node.ID] = true
+	}
+
+	return ids
+}
+
+func (conversation *GetConversationResponse) nodeSummary(node ConversationNode, activePathIDs map[string]bool) ConversationNodeSummary {
+	summary := ConversationNodeSummary{
+		ID:           node.ID,
+		Parent:       node.Parent,
+		Children:     node.Children,
+		IsActivePath: activePathIDs[node.ID],
+	}
+	if summary.Children == nil {
+		summary.Children = []string{}
+	}
+
+	if message := node.Message; message != nil {
+		summary.Role = message.Author.Role
+		summary.ContentType = message.Content.ContentType
+		summary.Text = message.text()
+		summary.ModelSlug = message.Metadata.ModelSlug
+		if message.CreateTime != nil {
+			createTime := unixTime(*message.CreateTime)
+			summary.CreateTime = &createTime
+		}
+	}
+
+	return summary
+}
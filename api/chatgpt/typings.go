@@ -1,10 +1,23 @@
 package chatgpt
 
 //goland:noinspection GoSnakeCaseUsage
-import tls_client "github.com/bogdanfinn/tls-client"
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/linweiyuan/go-chatgpt-api/api"
+	"github.com/linweiyuan/go-chatgpt-api/api/archive"
+	"github.com/linweiyuan/go-chatgpt-api/api/platform"
+
+	tls_client "github.com/bogdanfinn/tls-client"
+)
 
 type UserLogin struct {
 	client tls_client.HttpClient
+	// the captcha of the login page if required, and the answer of it
+	captchaImage string
+	captcha      string
 }
 
 type CreateConversationRequest struct {
@@ -18,6 +31,11 @@ type CreateConversationRequest struct {
 	ArkoseToken                string    `json:"arkose_token"`
 	HistoryAndTrainingDisabled bool      `json:"history_and_training_disabled"`
 	AutoContinue               bool      `json:"auto_continue"`
+	Delta                      bool      `json:"delta"`
+	Buffered                   bool      `json:"buffered"`
+
+	sessionKey string
+	recorder   *conversationRecorder
 }
 
 type Message struct {
@@ -66,6 +84,165 @@ type CreateConversationResponse struct {
 	Error          interface{} `json:"error"`
 }
 
+type CompletionsRequest struct {
+	platform.CreateCompletionsRequest
+	HideConversation bool `json:"hide_conversation"`
+}
+
+type ConversationDeltaResponse struct {
+	Type           string `json:"type"`
+	ConversationID string `json:"conversation_id"`
+	MessageID      string `json:"message_id"`
+	Delta          string `json:"delta,omitempty"`
+	Text           string `json:"text,omitempty"`
+	ModelSlug      string `json:"model_slug,omitempty"`
+	FinishReason   string `json:"finish_reason,omitempty"`
+}
+
+type GetConversationResponse struct {
+	Title          string                      `json:"title"`
+	CreateTime     float64                     `json:"create_time"`
+	UpdateTime     float64                     `json:"update_time"`
+	Mapping        map[string]ConversationNode `json:"mapping"`
+	CurrentNode    string                      `json:"current_node"`
+	ConversationID string                      `json:"conversation_id"`
+}
+
+type ConversationNode struct {
+	ID       string               `json:"id"`
+	Message  *ConversationMessage `json:"message"`
+	Parent   *string              `json:"parent"`
+	Children []string             `json:"children"`
+}
+
+type ConversationMessage struct {
+	ID         string              `json:"id"`
+	Author     Author              `json:"author"`
+	CreateTime *float64            `json:"create_time"`
+	UpdateTime *float64            `json:"update_time"`
+	Content    ConversationContent `json:"content"`
+	Status     string              `json:"status"`
+	EndTurn    *bool               `json:"end_turn"`
+	Weight     float64             `json:"weight"`
+	Metadata   struct {
+		ModelSlug     string `json:"model_slug,omitempty"`
+		FinishDetails *struct {
+			Type string `json:"type"`
+		} `json:"finish_details,omitempty"`
+	} `json:"metadata"`
+	Recipient string `json:"recipient"`
+}
+
+type ConversationContent struct {
+	ContentType string        `json:"content_type"`
+	Parts       []interface{} `json:"parts,omitempty"` // not only strings for multimodal messages
+	Text        string        `json:"text,omitempty"`  // code and execution output
+}
+
+type ConversationNodeSummary struct {
+	ID           string     `json:"id"`
+	Parent       *string    `json:"parent"`
+	Children     []string   `json:"children"`
+	Role         string     `json:"role,omitempty"`
+	ContentType  string     `json:"content_type,omitempty"`
+	Text         string     `json:"text"`
+	ModelSlug    string     `json:"model_slug,omitempty"`
+	CreateTime   *time.Time `json:"create_time,omitempty"`
+	IsActivePath bool       `json:"is_active_path"`
+}
+
+type ConversationCurrentNodeResponse struct {
+	ConversationID string                  `json:"conversation_id"`
+	CurrentNode    ConversationNodeSummary `json:"current_node"`
+}
+
+type ConversationBranchesResponse struct {
+	ConversationID string                    `json:"conversation_id"`
+	MessageID      string                    `json:"message_id"`
+	CurrentNode    string                    `json:"current_node"`
+	Branches       []ConversationNodeSummary `json:"branches"`
+}
+
+type ConversationPathResponse struct {
+	ConversationID string                    `json:"conversation_id"`
+	MessageID      string                    `json:"message_id"`
+	CurrentNode    string                    `json:"current_node"`
+	Path           []ConversationNodeSummary `json:"path"`
+}
+
+type ConversationExport struct {
+	ID         string          `json:"id"`
+	Title      string          `json:"title"`
+	CreateTime time.Time       `json:"create_time"`
+	UpdateTime time.Time       `json:"update_time"`
+	Messages   []ExportMessage `json:"messages"`
+}
+
+type ExportMessage struct {
+	ID          string     `json:"id"`
+	Role        string     `json:"role"`
+	ContentType string     `json:"content_type"`
+	Text        string     `json:"text"`
+	CreateTime  *time.Time `json:"create_time,omitempty"`
+}
+
+type GetConversationsResponse struct {
+	Items  []ConversationItem `json:"items"`
+	Total  int                `json:"total"`
+	Limit  int                `json:"limit"`
+	Offset int                `json:"offset"`
+}
+
+type ConversationItem struct {
+	ID         string      `json:"id"`
+	Title      string      `json:"title"`
+	CreateTime interface{} `json:"create_time"`
+	UpdateTime interface{} `json:"update_time"`
+}
+
+type exportJob struct {
+	mutex       sync.Mutex
+	id          string
+	owner       string
+	accessToken string
+	status      string
+	total       int
+	exported    int
+	failed      int
+	err         string
+	items       []ConversationItem
+	createTime  time.Time
+	finishTime  *time.Time
+}
+
+type ExportJobResponse struct {
+	JobID      string     `json:"job_id"`
+	Status     string     `json:"status"`
+	Total      int        `json:"total"`
+	Exported   int        `json:"exported"`
+	Failed     int        `json:"failed"`
+	Error      string     `json:"error,omitempty"`
+	CreateTime time.Time  `json:"create_time"`
+	FinishTime *time.Time `json:"finish_time,omitempty"`
+}
+
+type ExportManifest struct {
+	CreateTime    time.Time              `json:"create_time"`
+	Total         int                    `json:"total"`
+	Exported      int                    `json:"exported"`
+	Failed        int                    `json:"failed"`
+	Conversations []ExportManifestRecord `json:"conversations"`
+}
+
+type ExportManifestRecord struct {
+	ID         string      `json:"id"`
+	Title      string      `json:"title"`
+	CreateTime interface{} `json:"create_time"`
+	UpdateTime interface{} `json:"update_time"`
+	Files      []string    `json:"files,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
 type FeedbackMessageRequest struct {
 	MessageID      string `json:"message_id"`
 	ConversationID string `json:"conversation_id"`
@@ -81,8 +258,153 @@ type PatchConversationRequest struct {
 	IsVisible bool    `json:"is_visible"`
 }
 
+type AuthSessionResponse struct {
+	AccessToken string `json:"accessToken"`
+	Expires     string `json:"expires"`
+}
+
+type SessionTokenLoginRequest struct {
+	SessionToken string `json:"session_token"`
+}
+
+type SessionTokenLoginResponse struct {
+	AccessToken  string    `json:"access_token"`
+	Expires      time.Time `json:"expires"`
+	SessionToken string    `json:"session_token"`
+}
+
+type pendingLogin struct {
+	id        string
+	loginInfo api.LoginInfo
+	userLogin *UserLogin
+	state     string
+	step      string
+	challenge string
+	expires   time.Time
+}
+
+type ContinueLoginRequest struct {
+	LoginID string `json:"login_id"`
+	Answer  string `json:"answer"`
+}
+
+// LoginFlowResponse is either a pending challenge (captcha, otp or email) or the auth session when done
+type LoginFlowResponse struct {
+	LoginID      string          `json:"login_id,omitempty"`
+	Status       string          `json:"status"`
+	Challenge    string          `json:"challenge,omitempty"`
+	CaptchaImage string          `json:"captcha_image,omitempty"`
+	ExpiresAt    *time.Time      `json:"expires_at,omitempty"`
+	AuthSession  json.RawMessage `json:"auth_session,omitempty"`
+}
+
+type ArkosePoolStatsResponse struct {
+	Enabled   bool    `json:"enabled"`
+	Size      int     `json:"size"`
+	Depth     int     `json:"depth"`
+	TTL       string  `json:"ttl"`
+	Hits      int     `json:"hits"`
+	Misses    int     `json:"misses"`
+	HitRate   float64 `json:"hit_rate"`
+	Fetched   int     `json:"fetched"`
+	Failures  int     `json:"failures"`
+	Expired   int     `json:"expired"`
+	LastError string  `json:"last_error,omitempty"`
+}
+
+type GetModelsResponse struct {
+	Models []ModelInfo `json:"models"`
+}
+
+type ModelInfo struct {
+	Slug         string                 `json:"slug"`
+	Tags         []string               `json:"tags"`
+	Capabilities map[string]interface{} `json:"capabilities"`
+	EnabledTools []string               `json:"enabled_tools"`
+}
+
+type accountModels struct {
+	arkoseModels map[string]bool
+	expires      time.Time
+}
+
+type managedSession struct {
+	id          string
+	fingerprint string
+	credentials []byte // encrypted login info
+	accessToken string
+	expires     time.Time
+	renewError  string
+	// the backoff of the failed renewals, the renewal is stopped after repeated auth errors
+	renewFailures int
+	authFailures  int
+	nextRenewTime time.Time
+	renewStopped  bool
+}
+
+type ManagedSessionResponse struct {
+	SessionID  string    `json:"session_id"`
+	Expires    time.Time `json:"expires"`
+	RenewError string    `json:"renew_error,omitempty"`
+	// the session is not renewed any more, it must be created again
+	RenewStopped bool `json:"renew_stopped,omitempty"`
+}
+
+// AccountHealth is the latest result of the account check of a registered access token
+type AccountHealth struct {
+	ID         string     `json:"id"`
+	Email      string     `json:"email"`
+	Status     string     `json:"status"`
+	StatusCode int        `json:"status_code"`
+	Message    string     `json:"message,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	CheckTime  time.Time  `json:"check_time"`
+	ChangeTime time.Time  `json:"change_time"`
+}
+
+type AccountsHealthResponse struct {
+	Items     []AccountHealth `json:"items"`
+	Total     int             `json:"total"`
+	Interval  string          `json:"interval"`
+	CheckTime *time.Time      `json:"check_time"`
+}
+
+// AccountStatusChangeEvent is posted to the webhook when the status of an account changes
+type AccountStatusChangeEvent struct {
+	AccountHealth
+	PreviousStatus string `json:"previous_status"`
+}
+
 type Cookie struct {
 	Name   string `json:"name"`
 	Value  string `json:"value"`
 	Expiry int64  `json:"expiry"`
 }
+
+type conversationLineHandler func(line string, response *CreateConversationResponse)
+
+type conversationSession struct {
+	conversationID  string
+	parentMessageID string
+	updateTime      time.Time
+}
+
+type conversationRecorder struct {
+	tracker        *messageTextTracker
+	conversationID string
+	message        archive.Message
+}
+
+type assistantTextResponse struct {
+	conversationID string
+	messageID      string
+	text           string
+	finishType     string
+}
+
+// messageTextTracker turns the accumulated text that the backend sends on every event into deltas
+type messageTextTracker struct {
+	last       map[string]string
+	text       map[string]string
+	messageIDs []string
+}
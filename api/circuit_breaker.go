@@ -0,0 +1,292 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/linweiyuan/go-chatgpt-api/util/logger"
+
+	http "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
+)
+
+const (
+	CircuitStateClosed   = "closed"
+	CircuitStateOpen     = "open"
+	CircuitStateHalfOpen = "half_open"
+
+	defaultCircuitFailureThreshold = 5
+	defaultCircuitOpenTimeout      = 30 * time.Second
+
+	CircuitOpenErrorMessage = "Upstream is unavailable, try again later."
+)
+
+// every upstream host has a circuit breaker, it opens after the configured number of consecutive failures
+// (connection errors and 5xx), then the requests to the host fail fast until the open timeout passes,
+// after that one request is let through (half-open) and its result closes or opens the breaker again
+var (
+	circuitBreakers         = make(map[string]*circuitBreaker)
+	circuitBreakersMutex    sync.Mutex
+	circuitFailureThreshold = defaultCircuitFailureThreshold
+	circuitOpenTimeout      = defaultCircuitOpenTimeout
+)
+
+type circuitBreaker struct {
+	host                string
+	state               string
+	consecutiveFailures int
+	openTime            time.Time
+	probing             bool
+	lastError           string
+}
+
+// CircuitOpenError is returned instead of sending the request while the breaker of the host is open
+type CircuitOpenError struct {
+	Host       string
+	RetryAfter time.Duration
+}
+
+func (err *CircuitOpenError) Error() string {
+	return CircuitOpenErrorMessage + " (" + err.Host + ")"
+}
+
+type CircuitOpenResponse struct {
+	ErrorMessage string `json:"errorMessage"`
+	Host         string `json:"host"`
+	State        string `json:"state"`
+	RetryAfter   int    `json:"retry_after"`
+}
+
+type CircuitBreakerStatus struct {
+	Host                string     `json:"host"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenTime            *time.Time `json:"open_time,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+}
+
+type CircuitBreakersResponse struct {
+	Items            []CircuitBreakerStatus `json:"items"`
+	FailureThreshold int                    `json:"failure_threshold"`
+	OpenTimeout      string                 `json:"open_timeout"`
+}
+
+// breakerClient sends the requests of the wrapped client through the circuit breaker of the host
+type breakerClient struct {
+	tls_client.HttpClient
+}
+
+//goland:noinspection SpellCheckingInspection
+func init() {
+	if threshold, err := strconv.Atoi(os.Getenv("GO_CHATGPT_API_CIRCUIT_FAILURE_THRESHOLD")); err == nil {
+		circuitFailureThreshold = threshold
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("GO_CHATGPT_API_CIRCUIT_OPEN_TIMEOUT")); err == nil && timeout > 0 {
+		circuitOpenTimeout = timeout
+	}
+}
+
+func newBreakerClient(client tls_client.HttpClient) tls_client.HttpClient {
+	return &breakerClient{
+		HttpClient: client,
+	}
+}
+
+func (client *breakerClient) Do(req *http.Request) (*http.Response, error) {
+	// 0 or less disables the breakers
+	if circuitFailureThreshold <= 0 {
+		return client.HttpClient.Do(req)
+	}
+
+	breaker := getCircuitBreaker(req.URL.Host)
+	if err := breaker.allow(); err != nil {
+		return nil, err
+	}
+
+	resp, err := client.HttpClient.Do(req)
+	switch {
+	case err != nil && errors.Is(req.Context().Err(), context.Canceled):
+		// the caller is gone, which says nothing about the upstream
+		breaker.cancel()
+	case err != nil:
+		breaker.record(false, err.Error())
+	case resp.StatusCode >= http.StatusInternalServerError:
+		breaker.record(false, resp.Status)
+	default:
+		breaker.record(true, "")
+	}
+
+	return resp, err
+}
+
+func (client *breakerClient) Get(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Do(req)
+}
+
+func (client *breakerClient) Head(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodHead, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Do(req)
+}
+
+func (client *breakerClient) Post(url string, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	return client.Do(req)
+}
+
+func getCircuitBreaker(host string) *circuitBreaker {
+	circuitBreakersMutex.Lock()
+	defer circuitBreakersMutex.Unlock()
+
+	breaker, ok := circuitBreakers[host]
+	if !ok {
+		breaker = &circuitBreaker{
+			host:  host,
+			state: CircuitStateClosed,
+		}
+		circuitBreakers[host] = breaker
+	}
+
+	return breaker
+}
+
+func (breaker *circuitBreaker) allow() error {
+	circuitBreakersMutex.Lock()
+	defer circuitBreakersMutex.Unlock()
+
+	if breaker.state == CircuitStateClosed {
+		return nil
+	}
+
+	retryAfter := time.Until(breaker.openTime.Add(circuitOpenTimeout))
+	if breaker.state == CircuitStateOpen && retryAfter <= 0 {
+		breaker.state = CircuitStateHalfOpen
+		logger.Info("Circuit breaker of " + breaker.host + " is half-open.")
+	}
+
+	// only one request probes the host, the others still fail fast
+	if breaker.state == CircuitStateHalfOpen && !breaker.probing {
+		breaker.probing = true
+		return nil
+	}
+
+	if retryAfter < time.Second {
+		retryAfter = time.Second
+	}
+	return &CircuitOpenError{
+		Host:       breaker.host,
+		RetryAfter: retryAfter,
+	}
+}
+
+func (breaker *circuitBreaker) record(success bool, lastError string) {
+	circuitBreakersMutex.Lock()
+	defer circuitBreakersMutex.Unlock()
+
+	breaker.probing = false
+	if success {
+		if breaker.state != CircuitStateClosed {
+			logger.Info("Circuit breaker of " + breaker.host + " is closed.")
+		}
+		breaker.state = CircuitStateClosed
+		breaker.consecutiveFailures = 0
+		return
+	}
+
+	breaker.consecutiveFailures++
+	breaker.lastError = lastError
+	if breaker.state == CircuitStateHalfOpen || breaker.consecutiveFailures >= circuitFailureThreshold {
+		if breaker.state != CircuitStateOpen {
+			logger.Error("Circuit breaker of " + breaker.host + " is open: " + lastError)
+		}
+		breaker.state = CircuitStateOpen
+		breaker.openTime = time.Now()
+	}
+}
+
+// cancel lets another request probe the host if the probing one is canceled
+func (breaker *circuitBreaker) cancel() {
+	circuitBreakersMutex.Lock()
+	defer circuitBreakersMutex.Unlock()
+
+	breaker.probing = false
+}
+
+// ErrorStatusCode is the status code of the error of a client call, 503 if the breaker is open, otherwise 500
+func ErrorStatusCode(err error) int {
+	var circuitOpenError *CircuitOpenError
+	if errors.As(err, &circuitOpenError) {
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusInternalServerError
+}
+
+// AbortWithClientError aborts the request with the error of a client call,
+// an open breaker is told with 503 and Retry-After so that the client knows when to try again
+func AbortWithClientError(c *gin.Context, err error) {
+	var circuitOpenError *CircuitOpenError
+	if !errors.As(err, &circuitOpenError) {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, ReturnMessage(err.Error()))
+		return
+	}
+
+	retryAfter := int(math.Ceil(circuitOpenError.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.AbortWithStatusJSON(http.StatusServiceUnavailable, CircuitOpenResponse{
+		ErrorMessage: CircuitOpenErrorMessage,
+		Host:         circuitOpenError.Host,
+		State:        CircuitStateOpen,
+		RetryAfter:   retryAfter,
+	})
+}
+
+// GetCircuitBreakers shows the breaker of each upstream host which has been called
+func GetCircuitBreakers(c *gin.Context) {
+	circuitBreakersMutex.Lock()
+	items := make([]CircuitBreakerStatus, 0, len(circuitBreakers))
+	for _, breaker := range circuitBreakers {
+		status := CircuitBreakerStatus{
+			Host:                breaker.host,
+			State:               breaker.state,
+			ConsecutiveFailures: breaker.consecutiveFailures,
+			LastError:           breaker.lastError,
+		}
+		if breaker.state != CircuitStateClosed {
+			openTime := breaker.openTime
+			status.OpenTime = &openTime
+		}
+		items = append(items, status)
+	}
+	circuitBreakersMutex.Unlock()
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Host < items[j].Host
+	})
+	c.JSON(http.StatusOK, CircuitBreakersResponse{
+		Items:            items,
+		FailureThreshold: circuitFailureThreshold,
+		OpenTimeout:      circuitOpenTimeout.String(),
+	})
+}
@@ -3,7 +3,10 @@ package api
 //goland:noinspection GoSnakeCaseUsage
 import (
 	"bytes"
+	"crypto/rand"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"strings"
@@ -39,6 +42,12 @@ const (
 	EmailInvalidErrorMessage           = "Email is not valid."
 	EmailOrPasswordInvalidErrorMessage = "Email or password is not correct."
 	GetAccessTokenErrorMessage         = "Failed to get access token."
+	LoginMfaOtpChallengePath           = "/u/mfa-otp-challenge"
+	LoginMfaOtpChallengeUrl            = Auth0Url + LoginMfaOtpChallengePath + "?state="
+	LoginMfaEmailChallengePath         = "/u/mfa-email-challenge"
+	OTPRequiredErrorMessage            = "Two-factor authentication is enabled, otp or totp_secret is required."
+	EmailCodeRequiredErrorMessage      = "Email verification is required, use the resumable login to enter the code."
+	OTPInvalidErrorMessage             = "OTP is not correct."
 	defaultTimeoutSeconds              = 300 // 5 minutes
 
 	ReadyHint = "Service go-chatgpt-api is ready."
@@ -46,9 +55,19 @@ const (
 
 var Client tls_client.HttpClient
 
+// ErrOTPRequired is returned by CheckPassword when Auth0 redirects to the OTP challenge,
+// the first return value is the state of the challenge then
+var ErrOTPRequired = errors.New(OTPRequiredErrorMessage)
+
+// ErrEmailCodeRequired is the same as ErrOTPRequired, but the code is sent by email
+var ErrEmailCodeRequired = errors.New(EmailCodeRequiredErrorMessage)
+
 type LoginInfo struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	// the code of the two-factor authentication, or the secret to generate it
+	OTP        string `json:"otp,omitempty"`
+	TOTPSecret string `json:"totp_secret,omitempty"`
 }
 
 type UsageParam struct {
@@ -61,16 +80,18 @@ type AuthLogin interface {
 	GetState(authorizedUrl string) (string, int, error)
 	CheckUsername(state string, username string) (int, error)
 	CheckPassword(state string, username string, password string) (string, int, error)
+	CheckOTP(state string, otp string) (string, int, error)
 	GetAccessToken(code string) (string, int, error)
 }
 
 //goland:noinspection GoUnhandledErrorResult
 func init() {
-	Client, _ = tls_client.NewHttpClient(tls_client.NewNoopLogger(), []tls_client.HttpClientOption{
+	client, _ := tls_client.NewHttpClient(tls_client.NewNoopLogger(), []tls_client.HttpClientOption{
 		tls_client.WithCookieJar(tls_client.NewCookieJar()),
 		tls_client.WithTimeoutSeconds(defaultTimeoutSeconds),
 		tls_client.WithClientProfile(tls_client.Okhttp4Android13),
 	}...)
+	Client = newBreakerClient(client)
 }
 
 //goland:noinspection GoUnhandledErrorResult,SpellCheckingInspection
@@ -85,7 +106,7 @@ func NewHttpClient() tls_client.HttpClient {
 		client.SetProxy(proxyUrl)
 	}
 
-	return client
+	return newBreakerClient(client)
 }
 
 //goland:noinspection GoUnhandledErrorResult
@@ -114,10 +135,18 @@ func Proxy(c *gin.Context) {
 		req, _ = http.NewRequest(method, url, bytes.NewReader(body))
 	}
 	req.Header.Set("User-Agent", UserAgent)
-	req.Header.Set("Authorization", GetAccessToken(c.GetHeader(AuthorizationHeader)))
-	resp, err := Client.Do(req)
+	var resp *http.Response
+	var err error
+	if strings.HasPrefix(url, ChatGPTApiUrlPrefix) {
+		resp, err = DoWithRetry(c.Request.Context(), RetryGroupChatGPT, req, func(req *http.Request) (*http.Response, error) {
+			return DoWithAccessToken(req, c.GetHeader(AuthorizationHeader), conversationIDFromPath(url))
+		})
+	} else {
+		req.Header.Set("Authorization", GetAccessToken(c.GetHeader(AuthorizationHeader)))
+		resp, err = DoWithRetry(c.Request.Context(), RetryGroupPlatform, req, Client.Do)
+	}
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, ReturnMessage(err.Error()))
+		AbortWithClientError(c, err)
 		return
 	}
 
@@ -132,12 +161,33 @@ func Proxy(c *gin.Context) {
 	io.Copy(c.Writer, resp.Body)
 }
 
+// conversationIDFromPath returns the ID after /conversation/ of the backend API, which is used to pick the pooled token
+func conversationIDFromPath(url string) string {
+	_, after, found := strings.Cut(url, "/backend-api/conversation/")
+	if !found {
+		return ""
+	}
+
+	conversationID, _, _ := strings.Cut(after, "/")
+	conversationID, _, _ = strings.Cut(conversationID, "?")
+	return conversationID
+}
+
 func ReturnMessage(msg string) gin.H {
 	return gin.H{
 		defaultErrorMessageKey: msg,
 	}
 }
 
+// NewUUID returns a random (version 4) UUID, which is the format of message and conversation IDs
+func NewUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
 func GetAccessToken(accessToken string) string {
 	if !strings.HasPrefix(accessToken, "Bearer") {
 		return "Bearer " + accessToken
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	http "github.com/bogdanfinn/fhttp"
+)
+
+const (
+	jwtProfileClaim = "https://api.openai.com/profile"
+	jwtAuthClaim    = "https://api.openai.com/auth"
+
+	ParseAccessTokenErrorMessage = "Failed to parse access token, it is not a JWT."
+	AccessTokenExpiredMessage    = "Access token is expired at "
+)
+
+type AccessTokenClaims struct {
+	Email         string                 `json:"email"`
+	EmailVerified bool                   `json:"email_verified"`
+	UserID        string                 `json:"user_id"`
+	Subject       string                 `json:"sub"`
+	Issuer        string                 `json:"iss"`
+	Audience      []string               `json:"aud"`
+	Scopes        []string               `json:"scopes"`
+	Auth          map[string]interface{} `json:"auth"` // plan related claims of the account
+	IssuedAt      time.Time              `json:"issued_at"`
+	ExpiresAt     time.Time              `json:"expires_at"`
+	Expired       bool                   `json:"expired"`
+}
+
+type jwtPayload struct {
+	Profile struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	} `json:"https://api.openai.com/profile"`
+	Auth     map[string]interface{} `json:"https://api.openai.com/auth"`
+	Subject  string                 `json:"sub"`
+	Issuer   string                 `json:"iss"`
+	Audience interface{}            `json:"aud"` // string or array
+	Scope    string                 `json:"scope"`
+	IssuedAt int64                  `json:"iat"`
+	Expiry   int64                  `json:"exp"`
+}
+
+// IntrospectToken decodes the ChatGPT or platform access token of the Authorization header locally, the signature is not verified,
+// the token is not accepted in the query, which would end up in the access logs
+func IntrospectToken(c *gin.Context) {
+	claims, err := ParseAccessToken(c.GetHeader(AuthorizationHeader))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ReturnMessage(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, claims)
+}
+
+// ParseAccessToken returns the claims of the JWT without any upstream call
+func ParseAccessToken(accessToken string) (*AccessTokenClaims, error) {
+	accessToken = strings.TrimSpace(strings.TrimPrefix(accessToken, "Bearer"))
+	segments := strings.Split(accessToken, ".")
+	if len(segments) != 3 {
+		return nil, errors.New(ParseAccessTokenErrorMessage)
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segments[1], "="))
+	if err != nil {
+		return nil, errors.New(ParseAccessTokenErrorMessage)
+	}
+
+	var payload jwtPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, errors.New(ParseAccessTokenErrorMessage)
+	}
+
+	claims := &AccessTokenClaims{
+		Email:         payload.Profile.Email,
+		EmailVerified: payload.Profile.EmailVerified,
+		Subject:       payload.Subject,
+		Issuer:        payload.Issuer,
+		Scopes:        strings.Fields(payload.Scope),
+		Auth:          payload.Auth,
+		IssuedAt:      time.Unix(payload.IssuedAt, 0),
+		ExpiresAt:     time.Unix(payload.Expiry, 0),
+		Expired:       payload.Expiry != 0 && time.Now().Unix() >= payload.Expiry,
+	}
+	if userID, ok := payload.Auth["user_id"].(string); ok {
+		claims.UserID = userID
+	}
+
+	switch audience := payload.Audience.(type) {
+	case string:
+		claims.Audience = []string{audience}
+	case []interface{}:
+		for _, item := range audience {
+			if value, ok := item.(string); ok {
+				claims.Audience = append(claims.Audience, value)
+			}
+		}
+	}
+
+	return claims, nil
+}
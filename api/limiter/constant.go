@@ -0,0 +1,24 @@
+package limiter
+
+import "time"
+
+const (
+	// ContextKey holds the caller identity of the request in the gin context
+	ContextKey = "rateLimitIdentity"
+
+	requestWindow       = time.Minute
+	stateSweepInterval  = time.Hour
+	stateExpireTime     = 24 * time.Hour
+	dayLayout           = "2006-01-02"
+	streamRetryAfter    = time.Second
+	charactersPerToken  = 4
+	rateLimitErrorCode  = "rate_limit_exceeded"
+	limitTypeRequests   = "requests"
+	limitTypeStreams    = "streams"
+	limitTypeMessages   = "messages"
+	limitTypeTokens     = "tokens"
+	requestsLimitFormat = "Rate limit reached for requests per minute: Limit %d, Used %d. Please try again in %s."
+	streamsLimitFormat  = "Rate limit reached for concurrent streams: Limit %d, Used %d. Please try again when a stream is finished."
+	messagesLimitFormat = "Daily quota reached for messages: Limit %d, Used %d. Please try again in %s."
+	tokensLimitFormat   = "Daily quota reached for tokens: Limit %d, Used %d. Please try again in %s."
+)
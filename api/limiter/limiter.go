@@ -0,0 +1,220 @@
+package limiter
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	http "github.com/bogdanfinn/fhttp"
+)
+
+// the limits are counted per caller identity (a proxy key or an Authorization value),
+// requests per minute apply to all requests, the other limits only to the message requests
+var (
+	defaultLimits Limits
+
+	callerStates       = make(map[string]*callerState)
+	callerStatesMutex  sync.Mutex
+	lastStateSweepTime = time.Now()
+)
+
+//goland:noinspection SpellCheckingInspection
+func init() {
+	defaultLimits = Limits{
+		RequestsPerMinute: getIntEnv("GO_CHATGPT_API_RATE_LIMIT_RPM"),
+		ConcurrentStreams: getIntEnv("GO_CHATGPT_API_RATE_LIMIT_CONCURRENT_STREAMS"),
+		DailyMessages:     getIntEnv("GO_CHATGPT_API_QUOTA_DAILY_MESSAGES"),
+		DailyTokens:       getIntEnv("GO_CHATGPT_API_QUOTA_DAILY_TOKENS"),
+	}
+}
+
+func getIntEnv(key string) int {
+	value, _ := strconv.Atoi(os.Getenv(key))
+	return value
+}
+
+// GetLimits returns the limits of a caller, the zero fields of limits fall back to the defaults
+func GetLimits(limits *Limits) Limits {
+	merged := defaultLimits
+	if limits == nil {
+		return merged
+	}
+
+	if limits.RequestsPerMinute > 0 {
+		merged.RequestsPerMinute = limits.RequestsPerMinute
+	}
+	if limits.ConcurrentStreams > 0 {
+		merged.ConcurrentStreams = limits.ConcurrentStreams
+	}
+	if limits.DailyMessages > 0 {
+		merged.DailyMessages = limits.DailyMessages
+	}
+	if limits.DailyTokens > 0 {
+		merged.DailyTokens = limits.DailyTokens
+	}
+	return merged
+}
+
+// Acquire counts the request of the caller and sets the x-ratelimit-* headers,
+// the request is aborted with 429 if any limit is reached, otherwise release must be called when the request ends
+func Acquire(c *gin.Context, identity string, limits Limits, isMessage bool) (func(), bool) {
+	callerStatesMutex.Lock()
+	defer callerStatesMutex.Unlock()
+
+	now := time.Now()
+	sweepCallerStates(now)
+
+	state, ok := callerStates[identity]
+	if !ok {
+		state = &callerState{}
+		callerStates[identity] = state
+	}
+	state.lastRequestTime = now
+	state.rollover(now)
+	state.pruneRequests(now)
+
+	nextDay := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location()).Sub(now)
+	requestsReset := requestWindow
+	if len(state.requests) != 0 {
+		requestsReset = state.requests[0].Add(requestWindow).Sub(now)
+	}
+
+	if limits.RequestsPerMinute > 0 {
+		setLimitHeaders(c, limitTypeRequests, limits.RequestsPerMinute, len(state.requests)+1, requestsReset)
+	}
+	if isMessage && limits.DailyMessages > 0 {
+		setLimitHeaders(c, limitTypeMessages, limits.DailyMessages, state.messages+1, nextDay)
+	}
+	if limits.DailyTokens > 0 {
+		setLimitHeaders(c, limitTypeTokens, limits.DailyTokens, state.tokens, nextDay)
+	}
+
+	if limits.RequestsPerMinute > 0 && len(state.requests) >= limits.RequestsPerMinute {
+		reject(c, limitTypeRequests, requestsReset, requestsLimitFormat, limits.RequestsPerMinute, len(state.requests), formatDuration(requestsReset))
+		return nil, true
+	}
+
+	if isMessage {
+		if limits.ConcurrentStreams > 0 && state.streams >= limits.ConcurrentStreams {
+			reject(c, limitTypeStreams, streamRetryAfter, streamsLimitFormat, limits.ConcurrentStreams, state.streams)
+			return nil, true
+		}
+
+		if limits.DailyMessages > 0 && state.messages >= limits.DailyMessages {
+			reject(c, limitTypeMessages, nextDay, messagesLimitFormat, limits.DailyMessages, state.messages, formatDuration(nextDay))
+			return nil, true
+		}
+
+		if limits.DailyTokens > 0 && state.tokens >= limits.DailyTokens {
+			reject(c, limitTypeTokens, nextDay, tokensLimitFormat, limits.DailyTokens, state.tokens, formatDuration(nextDay))
+			return nil, true
+		}
+	}
+
+	state.requests = append(state.requests, now)
+	c.Set(ContextKey, identity)
+	if !isMessage {
+		return func() {}, false
+	}
+
+	state.streams++
+	state.messages++
+	return func() {
+		callerStatesMutex.Lock()
+		defer callerStatesMutex.Unlock()
+
+		state.streams--
+	}, false
+}
+
+// RecordTokens adds the used tokens to the daily quota of the caller of the request
+func RecordTokens(c *gin.Context, tokens int) {
+	identity := c.GetString(ContextKey)
+	if identity == "" || tokens <= 0 {
+		return
+	}
+
+	callerStatesMutex.Lock()
+	defer callerStatesMutex.Unlock()
+
+	if state, ok := callerStates[identity]; ok {
+		state.rollover(time.Now())
+		state.tokens += tokens
+	}
+}
+
+// EstimateTokens is used when the upstream does not report the usage, about 4 characters per token
+func EstimateTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+
+	return (utf8.RuneCountInString(text) + charactersPerToken - 1) / charactersPerToken
+}
+
+func (state *callerState) rollover(now time.Time) {
+	day := now.Format(dayLayout)
+	if state.day != day {
+		state.day = day
+		state.messages = 0
+		state.tokens = 0
+	}
+}
+
+func (state *callerState) pruneRequests(now time.Time) {
+	i := 0
+	for i < len(state.requests) && now.Sub(state.requests[i]) >= requestWindow {
+		i++
+	}
+	state.requests = state.requests[i:]
+}
+
+// sweepCallerStates drops the idle callers once in a while
+func sweepCallerStates(now time.Time) {
+	if now.Sub(lastStateSweepTime) < stateSweepInterval {
+		return
+	}
+
+	for identity, state := range callerStates {
+		if state.streams == 0 && now.Sub(state.lastRequestTime) >= stateExpireTime {
+			delete(callerStates, identity)
+		}
+	}
+	lastStateSweepTime = now
+}
+
+func setLimitHeaders(c *gin.Context, limitType string, limit int, used int, reset time.Duration) {
+	remaining := limit - used
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	c.Header("x-ratelimit-limit-"+limitType, strconv.Itoa(limit))
+	c.Header("x-ratelimit-remaining-"+limitType, strconv.Itoa(remaining))
+	c.Header("x-ratelimit-reset-"+limitType, formatDuration(reset))
+}
+
+func reject(c *gin.Context, limitType string, retryAfter time.Duration, format string, args ...interface{}) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, ErrorResponse{
+		Error: ErrorDetail{
+			Message: fmt.Sprintf(format, args...),
+			Type:    limitType,
+			Code:    rateLimitErrorCode,
+		},
+	})
+}
+
+func formatDuration(duration time.Duration) string {
+	if duration < time.Second {
+		duration = time.Second
+	}
+
+	return duration.Round(time.Second).String()
+}
@@ -0,0 +1,32 @@
+package limiter
+
+import "time"
+
+// Limits of a caller, zero means unlimited
+type Limits struct {
+	RequestsPerMinute int `json:"requests_per_minute"`
+	ConcurrentStreams int `json:"concurrent_streams"`
+	DailyMessages     int `json:"daily_messages"`
+	DailyTokens       int `json:"daily_tokens"`
+}
+
+type callerState struct {
+	requests        []time.Time
+	streams         int
+	day             string
+	messages        int
+	tokens          int
+	lastRequestTime time.Time
+}
+
+// ErrorResponse is the error format of the OpenAI API
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+type ErrorDetail struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    string  `json:"code"`
+}
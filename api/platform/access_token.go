@@ -27,7 +27,7 @@ func (userLogin *UserLogin) GetAuthorizedUrl(csrfToken string) (string, int, err
 	req.Header.Set("User-Agent", api.UserAgent)
 	resp, err := userLogin.client.Do(req)
 	if err != nil {
-		return "", http.StatusInternalServerError, err
+		return "", api.ErrorStatusCode(err), err
 	}
 
 	defer resp.Body.Close()
@@ -55,7 +55,7 @@ func (userLogin *UserLogin) CheckUsername(state string, username string) (int, e
 	req.Header.Set("User-Agent", api.UserAgent)
 	resp, err := userLogin.client.Do(req)
 	if err != nil {
-		return http.StatusInternalServerError, err
+		return api.ErrorStatusCode(err), err
 	}
 
 	defer resp.Body.Close()
@@ -79,7 +79,7 @@ func (userLogin *UserLogin) CheckPassword(state string, username string, passwor
 	req.Header.Set("User-Agent", api.UserAgent)
 	resp, err := userLogin.client.Do(req)
 	if err != nil {
-		return "", http.StatusInternalServerError, err
+		return "", api.ErrorStatusCode(err), err
 	}
 
 	defer resp.Body.Close()
@@ -87,9 +87,46 @@ func (userLogin *UserLogin) CheckPassword(state string, username string, passwor
 		return "", resp.StatusCode, errors.New(api.EmailOrPasswordInvalidErrorMessage)
 	}
 
+	// the redirects stop at the OTP challenge page if two-factor authentication is enabled
+	if strings.HasPrefix(resp.Request.URL.Path, api.LoginMfaOtpChallengePath) {
+		return resp.Request.URL.Query().Get("state"), http.StatusBadRequest, api.ErrOTPRequired
+	}
+
+	if strings.HasPrefix(resp.Request.URL.Path, api.LoginMfaEmailChallengePath) {
+		return "", http.StatusBadRequest, errors.New(emailCodeNotSupportedErrorMessage)
+	}
+
 	return resp.Request.URL.Query().Get("code"), http.StatusOK, nil
 }
 
+//goland:noinspection GoUnhandledErrorResult,GoErrorStringFormat
+func (userLogin *UserLogin) CheckOTP(state string, otp string) (string, int, error) {
+	formParams := fmt.Sprintf(
+		"state=%s&code=%s&action=default",
+		state,
+		otp,
+	)
+	req, _ := http.NewRequest(http.MethodPost, api.LoginMfaOtpChallengeUrl+state, strings.NewReader(formParams))
+	req.Header.Set("Content-Type", api.ContentType)
+	req.Header.Set("User-Agent", api.UserAgent)
+	resp, err := userLogin.client.Do(req)
+	if err != nil {
+		return "", api.ErrorStatusCode(err), err
+	}
+
+	defer resp.Body.Close()
+	if strings.HasPrefix(resp.Request.URL.Path, api.LoginMfaEmailChallengePath) {
+		return "", http.StatusBadRequest, errors.New(emailCodeNotSupportedErrorMessage)
+	}
+
+	code := resp.Request.URL.Query().Get("code")
+	if resp.StatusCode != http.StatusOK || strings.HasPrefix(resp.Request.URL.Path, api.LoginMfaOtpChallengePath) || code == "" {
+		return "", http.StatusBadRequest, errors.New(api.OTPInvalidErrorMessage)
+	}
+
+	return code, http.StatusOK, nil
+}
+
 //goland:noinspection GoUnhandledErrorResult,GoErrorStringFormat
 func (userLogin *UserLogin) GetAccessToken(code string) (string, int, error) {
 	jsonBytes, _ := json.Marshal(GetAccessTokenRequest{
@@ -103,7 +140,7 @@ func (userLogin *UserLogin) GetAccessToken(code string) (string, int, error) {
 	req.Header.Set("User-Agent", api.UserAgent)
 	resp, err := userLogin.client.Do(req)
 	if err != nil {
-		return "", http.StatusInternalServerError, err
+		return "", api.ErrorStatusCode(err), err
 	}
 
 	defer resp.Body.Close()
@@ -14,6 +14,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/linweiyuan/go-chatgpt-api/api"
+	"github.com/linweiyuan/go-chatgpt-api/api/limiter"
 
 	http "github.com/bogdanfinn/fhttp"
 )
@@ -31,7 +32,9 @@ func RetrieveModel(c *gin.Context) {
 func CreateChatCompletions(c *gin.Context) {
 	body, _ := io.ReadAll(c.Request.Body)
 	var request struct {
-		Stream bool `json:"stream"`
+		Stream   bool                     `json:"stream"`
+		Prompt   json.RawMessage          `json:"prompt"`
+		Messages []ChatCompletionsMessage `json:"messages"`
 	}
 	json.Unmarshal(body, &request)
 
@@ -48,9 +51,20 @@ func CreateChatCompletions(c *gin.Context) {
 
 	defer resp.Body.Close()
 	if request.Stream {
-		handleCompletionsResponse(c, resp)
+		// the stream has no usage, so the tokens are estimated
+		prompt := string(request.Prompt)
+		for _, message := range request.Messages {
+			prompt += message.Content
+		}
+		text := handleCompletionsResponse(c, resp)
+		limiter.RecordTokens(c, limiter.EstimateTokens(prompt)+limiter.EstimateTokens(text))
 	} else {
-		io.Copy(c.Writer, resp.Body)
+		data, _ := io.ReadAll(resp.Body)
+		var response ChatCompletionsResponse
+		if json.Unmarshal(data, &response) == nil && response.Usage != nil {
+			limiter.RecordTokens(c, response.Usage.TotalTokens)
+		}
+		c.Writer.Write(data)
 	}
 }
 
@@ -58,10 +72,13 @@ func CreateCompletions(c *gin.Context) {
 	CreateChatCompletions(c)
 }
 
+// handleCompletionsResponse relays the event stream, then returns the generated text
+//
 //goland:noinspection GoUnhandledErrorResult
-func handleCompletionsResponse(c *gin.Context, resp *http.Response) {
+func handleCompletionsResponse(c *gin.Context, resp *http.Response) string {
 	c.Writer.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
 
+	var text strings.Builder
 	reader := bufio.NewReader(resp.Body)
 	for {
 		if c.Request.Context().Err() != nil {
@@ -80,12 +97,23 @@ func handleCompletionsResponse(c *gin.Context, resp *http.Response) {
 			continue
 		}
 
+		var chunk completionsChunk
+		if strings.HasPrefix(line, "data: ") && json.Unmarshal([]byte(line[6:]), &chunk) == nil {
+			for _, choice := range chunk.Choices {
+				text.WriteString(choice.Text)
+				if choice.Delta != nil {
+					text.WriteString(choice.Delta.Content)
+				}
+			}
+		}
+
 		c.Writer.Write([]byte(line + "\n\n"))
 		c.Writer.Flush()
 	}
 
 	defer resp.Body.Close()
 	io.Copy(c.Writer, resp.Body)
+	return text.String()
 }
 
 //goland:noinspection GoUnhandledErrorResult
@@ -143,9 +171,14 @@ func GetApiKeys(c *gin.Context) {
 //goland:noinspection GoUnhandledErrorResult
 func handleGet(c *gin.Context, url string) {
 	req, _ := http.NewRequest(http.MethodGet, url, nil)
-	req.Header.Set("Authorization", api.GetAccessToken(c.GetHeader(api.AuthorizationHeader)))
-	resp, _ := api.Client.Do(req)
+	req.Header.Set("Authorization", api.GetAccessToken(currentSessionKey(c.GetHeader(api.AuthorizationHeader))))
+	resp, err := api.DoWithRetry(c.Request.Context(), api.RetryGroupPlatform, req, api.Client.Do)
 	log.Println(req)
+	if err != nil {
+		api.AbortWithClientError(c, err)
+		return
+	}
+
 	defer resp.Body.Close()
 	io.Copy(c.Writer, resp.Body)
 }
@@ -158,9 +191,9 @@ func handlePost(c *gin.Context, url string, data []byte, stream bool) (*http.Res
 		req.Header.Set("Accept", "text/event-stream")
 	}
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := api.Client.Do(req)
+	resp, err := api.DoWithRetry(c.Request.Context(), api.RetryGroupPlatform, req, api.Client.Do)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(err.Error()))
+		api.AbortWithClientError(c, err)
 		return nil, err
 	}
 
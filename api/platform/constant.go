@@ -1,6 +1,10 @@
 package platform
 
-import "github.com/linweiyuan/go-chatgpt-api/api"
+import (
+	"time"
+
+	"github.com/linweiyuan/go-chatgpt-api/api"
+)
 
 //goland:noinspection SpellCheckingInspection
 const (
@@ -35,4 +39,19 @@ const (
 	auth0LogoutUrl            = api.Auth0Url + "/v2/logout?returnTo=https%3A%2F%2Fplatform.openai.com%2Floggedout&client_id=" + platformAuthClientID + "&auth0Client=" + auth0Client
 	dashboardLoginUrl         = "https://api.openai.com/dashboard/onboarding/login"
 	getSessionKeyErrorMessage = "Failed to get session key."
+
+	// the code of the email challenge is only sent after the challenge starts, but the platform login is done in one request,
+	// unlike the resumable ChatGPT login, there is nowhere to enter the code
+	emailCodeNotSupportedErrorMessage = "Email verification is required, which the platform login does not support."
+
+	platformRefreshGrantType         = "refresh_token"
+	refreshTokenBefore               = time.Hour
+	refreshTokenInterval             = 10 * time.Minute
+	refreshTokenNotFoundErrorMessage = "Refresh token is not found, please login again."
+	refreshTokenErrorMessage         = "Failed to refresh token."
+	refreshTokenRejectedErrorMessage = "Refresh token is rejected, the platform token is dropped, please login again."
+
+	roleSystem            = "system"
+	streamDone            = "[DONE]"
+	parseJsonErrorMessage = "Failed to parse json request body."
 )
@@ -1,7 +1,9 @@
 package platform
 
+//goland:noinspection GoSnakeCaseUsage
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"strings"
 
@@ -9,6 +11,7 @@ import (
 	"github.com/linweiyuan/go-chatgpt-api/api"
 
 	http "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
 )
 
 //goland:noinspection GoUnhandledErrorResult
@@ -24,7 +27,12 @@ func Login(c *gin.Context) {
 	}
 
 	// hard refresh cookies
-	resp, _ := userLogin.client.Get(auth0LogoutUrl)
+	resp, err := userLogin.client.Get(auth0LogoutUrl)
+	if err != nil {
+		api.AbortWithClientError(c, err)
+		return
+	}
+
 	defer resp.Body.Close()
 
 	// get authorized url
@@ -44,8 +52,8 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// check password
-	code, statusCode, err := userLogin.CheckPassword(state, loginInfo.Username, loginInfo.Password)
+	// check password (and OTP if two-factor authentication is enabled)
+	code, statusCode, err := api.CheckPasswordWithOTP(&userLogin, state, loginInfo)
 	if err != nil {
 		c.AbortWithStatusJSON(statusCode, api.ReturnMessage(err.Error()))
 		return
@@ -61,21 +69,38 @@ func Login(c *gin.Context) {
 	// get session key
 	var getAccessTokenResponse GetAccessTokenResponse
 	json.Unmarshal([]byte(accessToken), &getAccessTokenResponse)
+	data, statusCode, err := getDashboardSession(userLogin.client, getAccessTokenResponse.AccessToken)
+	if err != nil {
+		c.AbortWithStatusJSON(statusCode, api.ReturnMessage(err.Error()))
+		return
+	}
+
+	// keep the refresh token, then the session key can be renewed without password
+	saveRefreshToken(data, getAccessTokenResponse)
+
+	c.Writer.Write(data)
+}
+
+//goland:noinspection GoUnhandledErrorResult,GoErrorStringFormat
+func getDashboardSession(client tls_client.HttpClient, accessToken string) ([]byte, int, error) {
 	req, _ := http.NewRequest(http.MethodPost, dashboardLoginUrl, strings.NewReader("{}"))
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", api.UserAgent)
-	req.Header.Set("Authorization", api.GetAccessToken(getAccessTokenResponse.AccessToken))
-	resp, err = userLogin.client.Do(req)
+	req.Header.Set("Authorization", api.GetAccessToken(accessToken))
+	resp, err := client.Do(req)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.ReturnMessage(err.Error()))
-		return
+		return nil, api.ErrorStatusCode(err), err
 	}
 
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		c.AbortWithStatusJSON(resp.StatusCode, api.ReturnMessage(getSessionKeyErrorMessage))
-		return
+		return nil, resp.StatusCode, errors.New(getSessionKeyErrorMessage)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
 	}
 
-	io.Copy(c.Writer, resp.Body)
+	return data, http.StatusOK, nil
 }
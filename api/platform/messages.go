@@ -0,0 +1,150 @@
+package platform
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/linweiyuan/go-chatgpt-api/api/anthropic"
+	"github.com/linweiyuan/go-chatgpt-api/api/limiter"
+
+	http "github.com/bogdanfinn/fhttp"
+)
+
+// CreateMessages serves the Anthropic messages format with the OpenAI chat completions API
+//
+//goland:noinspection GoUnhandledErrorResult
+func CreateMessages(c *gin.Context) {
+	var request anthropic.MessagesRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, anthropic.NewErrorResponse(http.StatusBadRequest, parseJsonErrorMessage))
+		return
+	}
+
+	data, _ := json.Marshal(ConvertMessagesRequest(request))
+	resp, err := handlePost(c, apiCreateChatCompletions, data, request.Stream)
+	if err != nil {
+		return
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// the Anthropic SDKs only understand their own error format
+		data, _ := io.ReadAll(resp.Body)
+		var errorResponse ErrorResponse
+		message := http.StatusText(resp.StatusCode)
+		if err := json.Unmarshal(data, &errorResponse); err == nil && errorResponse.Error.Message != "" {
+			message = errorResponse.Error.Message
+		}
+		c.AbortWithStatusJSON(resp.StatusCode, anthropic.NewErrorResponse(resp.StatusCode, message))
+		return
+	}
+
+	id := anthropic.NewMessageID()
+	if !request.Stream {
+		var response ChatCompletionsResponse
+		json.NewDecoder(resp.Body).Decode(&response)
+
+		text := ""
+		finishReason := ""
+		if len(response.Choices) != 0 && response.Choices[0].Message != nil {
+			text = response.Choices[0].Message.Content
+			if response.Choices[0].FinishReason != nil {
+				finishReason = *response.Choices[0].FinishReason
+			}
+		}
+
+		usage := anthropic.Usage{}
+		if response.Usage != nil {
+			usage.InputTokens = response.Usage.PromptTokens
+			usage.OutputTokens = response.Usage.CompletionTokens
+			limiter.RecordTokens(c, response.Usage.TotalTokens)
+		}
+		c.JSON(http.StatusOK, anthropic.NewMessagesResponse(id, request.Model, text, anthropic.ConvertFinishReason(finishReason), usage))
+		return
+	}
+
+	anthropic.WriteMessageStart(c, id, request.Model)
+	finishReason := ""
+	var text strings.Builder
+	reader := bufio.NewReader(resp.Body)
+	for {
+		if c.Request.Context().Err() != nil {
+			break
+		}
+
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			break
+		}
+
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+
+		responseJson := line[6:]
+		if strings.HasPrefix(responseJson, streamDone) {
+			break
+		}
+
+		var response ChatCompletionsResponse
+		if err := json.Unmarshal([]byte(responseJson), &response); err != nil || len(response.Choices) == 0 {
+			continue
+		}
+
+		choice := response.Choices[0]
+		if choice.Delta != nil && choice.Delta.Content != "" {
+			anthropic.WriteTextDelta(c, choice.Delta.Content)
+			text.WriteString(choice.Delta.Content)
+		}
+		if choice.FinishReason != nil {
+			finishReason = *choice.FinishReason
+		}
+	}
+
+	anthropic.WriteMessageStop(c, anthropic.ConvertFinishReason(finishReason), anthropic.Usage{})
+
+	// the stream has no usage, so the tokens are estimated
+	prompt := request.SystemText()
+	for _, message := range request.Messages {
+		prompt += message.Text()
+	}
+	limiter.RecordTokens(c, limiter.EstimateTokens(prompt)+limiter.EstimateTokens(text.String()))
+}
+
+// ConvertMessagesRequest maps the Anthropic messages request to the chat completions request,
+// the system field becomes the first system message, and the Claude model is mapped to the OpenAI one
+func ConvertMessagesRequest(request anthropic.MessagesRequest) ChatCompletionsRequest {
+	messages := make([]ChatCompletionsMessage, 0, len(request.Messages)+1)
+	if system := request.SystemText(); system != "" {
+		messages = append(messages, ChatCompletionsMessage{
+			Role:    roleSystem,
+			Content: system,
+		})
+	}
+
+	for _, message := range request.Messages {
+		messages = append(messages, ChatCompletionsMessage{
+			Role:    message.Role,
+			Content: message.Text(),
+		})
+	}
+
+	var stop interface{}
+	if len(request.StopSequences) != 0 {
+		stop = request.StopSequences
+	}
+
+	return ChatCompletionsRequest{
+		Model:       anthropic.ConvertModel(request.Model),
+		Messages:    messages,
+		Temperature: request.Temperature,
+		TopP:        request.TopP,
+		Stream:      request.Stream,
+		Stop:        stop,
+		MaxTokens:   request.MaxTokens,
+	}
+}
@@ -0,0 +1,204 @@
+package platform
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/linweiyuan/go-chatgpt-api/api"
+	"github.com/linweiyuan/go-chatgpt-api/util/logger"
+
+	http "github.com/bogdanfinn/fhttp"
+)
+
+// the refresh tokens are kept by the session keys returned from Login, the session key is renewed in background,
+// and the session key of Login is replaced with the latest one when calling the dashboard APIs,
+// a token is dropped once the refresh token is rejected
+var (
+	platformTokens      = make(map[string]*platformToken)
+	platformTokensMutex sync.Mutex
+	platformTokensOnce  sync.Once
+)
+
+// RefreshToken exchanges the refresh token of the session key, then returns the new dashboard session as Login does
+func RefreshToken(c *gin.Context) {
+	platformTokensMutex.Lock()
+	token, ok := platformTokens[sessionKeyOf(c.GetHeader(api.AuthorizationHeader))]
+	platformTokensMutex.Unlock()
+
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, api.ReturnMessage(refreshTokenNotFoundErrorMessage))
+		return
+	}
+
+	data, statusCode, err := refreshPlatformToken(token)
+	if err != nil {
+		c.AbortWithStatusJSON(statusCode, api.ReturnMessage(err.Error()))
+		return
+	}
+
+	c.Writer.Write(data)
+}
+
+func saveRefreshToken(dashboardSession []byte, getAccessTokenResponse GetAccessTokenResponse) {
+	var dashboardLoginResponse DashboardLoginResponse
+	json.Unmarshal(dashboardSession, &dashboardLoginResponse)
+	sessionKey := dashboardLoginResponse.User.Session.SensitiveID
+	if sessionKey == "" || getAccessTokenResponse.RefreshToken == "" {
+		return
+	}
+
+	platformTokensMutex.Lock()
+	platformTokens[sessionKey] = &platformToken{
+		loginSessionKey: sessionKey,
+		sessionKey:      sessionKey,
+		accessToken:     getAccessTokenResponse.AccessToken,
+		refreshToken:    getAccessTokenResponse.RefreshToken,
+		expiresAt:       time.Now().Add(time.Duration(getAccessTokenResponse.ExpiresIn) * time.Second),
+	}
+	platformTokensMutex.Unlock()
+
+	platformTokensOnce.Do(func() {
+		go refreshPlatformTokens()
+	})
+}
+
+// currentSessionKey returns the latest session key if the authorization is a renewed one
+func currentSessionKey(authorization string) string {
+	platformTokensMutex.Lock()
+	defer platformTokensMutex.Unlock()
+
+	if token, ok := platformTokens[sessionKeyOf(authorization)]; ok {
+		return token.sessionKey
+	}
+
+	return authorization
+}
+
+func sessionKeyOf(authorization string) string {
+	return strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer"))
+}
+
+func refreshPlatformTokens() {
+	for {
+		time.Sleep(refreshTokenInterval)
+
+		platformTokensMutex.Lock()
+		tokens := make(map[*platformToken]bool)
+		for _, token := range platformTokens {
+			if time.Until(token.expiresAt) < refreshTokenBefore {
+				tokens[token] = true
+			}
+		}
+		platformTokensMutex.Unlock()
+
+		for token := range tokens {
+			if _, _, err := refreshPlatformToken(token); err != nil {
+				logger.Error("Failed to refresh platform token: " + err.Error())
+			}
+		}
+	}
+}
+
+// refreshPlatformToken uses grant_type=refresh_token, then gets a new dashboard session with the new access token,
+// only one refresh of a token runs at a time, the one which waits gets the result of the other if it is refreshed meanwhile
+//
+//goland:noinspection GoUnhandledErrorResult,GoErrorStringFormat
+func refreshPlatformToken(token *platformToken) ([]byte, int, error) {
+	platformTokensMutex.Lock()
+	seenRefreshCount := token.refreshCount
+	platformTokensMutex.Unlock()
+
+	token.refreshMutex.Lock()
+	defer token.refreshMutex.Unlock()
+
+	platformTokensMutex.Lock()
+	refreshToken := token.refreshToken
+	refreshCount := token.refreshCount
+	dashboardSession := token.dashboardSession
+	platformTokensMutex.Unlock()
+	if refreshCount != seenRefreshCount {
+		return dashboardSession, http.StatusOK, nil
+	}
+
+	client := api.NewHttpClient()
+	jsonBytes, _ := json.Marshal(RefreshTokenRequest{
+		ClientID:     platformAuthClientID,
+		GrantType:    platformRefreshGrantType,
+		RefreshToken: refreshToken,
+		RedirectURI:  platformAuthRedirectURL,
+	})
+	req, _ := http.NewRequest(http.MethodPost, getTokenUrl, strings.NewReader(string(jsonBytes)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", api.UserAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, api.ErrorStatusCode(err), err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// the refresh token is revoked or expired (invalid_grant), it will never work again
+		if resp.StatusCode >= http.StatusBadRequest && resp.StatusCode < http.StatusInternalServerError && resp.StatusCode != http.StatusTooManyRequests {
+			dropPlatformToken(token, refreshToken)
+		}
+
+		return nil, resp.StatusCode, errors.New(refreshTokenErrorMessage)
+	}
+
+	var getAccessTokenResponse GetAccessTokenResponse
+	body, _ := io.ReadAll(resp.Body)
+	if err := json.Unmarshal(body, &getAccessTokenResponse); err != nil || getAccessTokenResponse.AccessToken == "" {
+		return nil, http.StatusInternalServerError, errors.New(refreshTokenErrorMessage)
+	}
+
+	data, statusCode, err := getDashboardSession(client, getAccessTokenResponse.AccessToken)
+	if err != nil {
+		return nil, statusCode, err
+	}
+
+	var dashboardLoginResponse DashboardLoginResponse
+	json.Unmarshal(data, &dashboardLoginResponse)
+
+	platformTokensMutex.Lock()
+	defer platformTokensMutex.Unlock()
+
+	token.accessToken = getAccessTokenResponse.AccessToken
+	token.dashboardSession = data
+	token.refreshCount++
+	token.expiresAt = time.Now().Add(time.Duration(getAccessTokenResponse.ExpiresIn) * time.Second)
+	if getAccessTokenResponse.RefreshToken != "" {
+		token.refreshToken = getAccessTokenResponse.RefreshToken
+	}
+	if sessionKey := dashboardLoginResponse.User.Session.SensitiveID; sessionKey != "" && sessionKey != token.sessionKey {
+		// only the session key of Login (which the clients may still use) and the latest one are kept
+		if token.sessionKey != token.loginSessionKey {
+			delete(platformTokens, token.sessionKey)
+		}
+		token.sessionKey = sessionKey
+		platformTokens[sessionKey] = token
+	}
+
+	return data, http.StatusOK, nil
+}
+
+// dropPlatformToken removes the token only if the rejected refresh token is still the current one
+func dropPlatformToken(token *platformToken, rejectedRefreshToken string) {
+	platformTokensMutex.Lock()
+	defer platformTokensMutex.Unlock()
+
+	if token.refreshToken != rejectedRefreshToken {
+		return
+	}
+
+	for sessionKey, t := range platformTokens {
+		if t == token {
+			delete(platformTokens, sessionKey)
+		}
+	}
+	logger.Error(refreshTokenRejectedErrorMessage)
+}
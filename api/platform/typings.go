@@ -1,7 +1,13 @@
 package platform
 
 //goland:noinspection GoSnakeCaseUsage
-import tls_client "github.com/bogdanfinn/tls-client"
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	tls_client "github.com/bogdanfinn/tls-client"
+)
 
 type UserLogin struct {
 	client tls_client.HttpClient
@@ -23,21 +29,48 @@ type GetAccessTokenResponse struct {
 	TokenType    string `json:"token_type"`
 }
 
+type RefreshTokenRequest struct {
+	ClientID     string `json:"client_id"`
+	GrantType    string `json:"grant_type"`
+	RefreshToken string `json:"refresh_token"`
+	RedirectURI  string `json:"redirect_uri"`
+}
+
+type DashboardLoginResponse struct {
+	User struct {
+		Session struct {
+			SensitiveID string `json:"sensitive_id"`
+		} `json:"session"`
+	} `json:"user"`
+}
+
+type platformToken struct {
+	loginSessionKey string
+	sessionKey      string
+	accessToken     string
+	refreshToken    string
+	expiresAt       time.Time
+	// the latest dashboard session of the refresh, refreshMutex makes the refreshes of the token one by one
+	dashboardSession []byte
+	refreshCount     int
+	refreshMutex     sync.Mutex
+}
+
 //goland:noinspection SpellCheckingInspection
 type CreateCompletionsRequest struct {
 	Model            string                 `json:"model"`
-	Prompt           string                 `json:"prompt,omitempty"`
+	Prompt           json.RawMessage        `json:"prompt,omitempty"` // string or array
 	Suffix           string                 `json:"suffix,omitempty"`
 	MaxTokens        int                    `json:"max_tokens,omitempty"`
-	Temperature      int                    `json:"temperature,omitempty"`
-	TopP             int                    `json:"top_p,omitempty"`
+	Temperature      float64                `json:"temperature,omitempty"`
+	TopP             float64                `json:"top_p,omitempty"`
 	N                int                    `json:"n,omitempty"`
 	Stream           bool                   `json:"stream,omitempty"`
 	Logprobs         int                    `json:"logprobs,omitempty"`
 	Echo             bool                   `json:"echo,omitempty"`
-	Stop             string                 `json:"stop,omitempty"`
-	PresencePenalty  int                    `json:"presence_penalty,omitempty"`
-	FrequencyPenalty int                    `json:"frequency_penalty,omitempty"`
+	Stop             interface{}            `json:"stop,omitempty"` // string or array
+	PresencePenalty  float64                `json:"presence_penalty,omitempty"`
+	FrequencyPenalty float64                `json:"frequency_penalty,omitempty"`
 	BestOf           int                    `json:"best_of,omitempty"`
 	LogitBias        map[string]interface{} `json:"logit_bias,omitempty"`
 	User             string                 `json:"user,omitempty"`
@@ -46,14 +79,14 @@ type CreateCompletionsRequest struct {
 type ChatCompletionsRequest struct {
 	Model            string                   `json:"model"`
 	Messages         []ChatCompletionsMessage `json:"messages"`
-	Temperature      int                      `json:"temperature,omitempty"`
-	TopP             int                      `json:"top_p,omitempty"`
+	Temperature      float64                  `json:"temperature,omitempty"`
+	TopP             float64                  `json:"top_p,omitempty"`
 	N                int                      `json:"n,omitempty"`
 	Stream           bool                     `json:"stream,omitempty"`
-	Stop             string                   `json:"stop,omitempty"`
+	Stop             interface{}              `json:"stop,omitempty"` // string or array
 	MaxTokens        int                      `json:"max_tokens,omitempty"`
-	PresencePenalty  int                      `json:"presence_penalty,omitempty"`
-	FrequencyPenalty int                      `json:"frequency_penalty,omitempty"`
+	PresencePenalty  float64                  `json:"presence_penalty,omitempty"`
+	FrequencyPenalty float64                  `json:"frequency_penalty,omitempty"`
 	LogitBias        map[string]interface{}   `json:"logit_bias,omitempty"`
 	User             string                   `json:"user,omitempty"`
 }
@@ -64,6 +97,64 @@ type ChatCompletionsMessage struct {
 	Name    string `json:"name,omitempty"`
 }
 
+type ChatCompletionsResponse struct {
+	ID      string                  `json:"id"`
+	Object  string                  `json:"object"`
+	Created int64                   `json:"created"`
+	Model   string                  `json:"model"`
+	Choices []ChatCompletionsChoice `json:"choices"`
+	Usage   *Usage                  `json:"usage,omitempty"`
+}
+
+type ChatCompletionsChoice struct {
+	Index        int                     `json:"index"`
+	Message      *ChatCompletionsMessage `json:"message,omitempty"`
+	Delta        *ChatCompletionsDelta   `json:"delta,omitempty"`
+	FinishReason *string                 `json:"finish_reason"`
+}
+
+type ChatCompletionsDelta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+type CompletionsResponse struct {
+	ID      string              `json:"id"`
+	Object  string              `json:"object"`
+	Created int64               `json:"created"`
+	Model   string              `json:"model"`
+	Choices []CompletionsChoice `json:"choices"`
+	Usage   *Usage              `json:"usage,omitempty"`
+}
+
+type CompletionsChoice struct {
+	Text         string      `json:"text"`
+	Index        int         `json:"index"`
+	Logprobs     interface{} `json:"logprobs"`
+	FinishReason *string     `json:"finish_reason"`
+}
+
+// completionsChunk is a stream event of both the chat completions and the completions
+type completionsChunk struct {
+	Choices []struct {
+		Text  string                `json:"text"`
+		Delta *ChatCompletionsDelta `json:"delta"`
+	} `json:"choices"`
+}
+
+type ErrorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
+
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
 type CreateEditRequest struct {
 	Model       string `json:"model"`
 	Input       string `json:"input"`
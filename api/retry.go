@@ -0,0 +1,187 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/linweiyuan/go-chatgpt-api/util/logger"
+
+	http "github.com/bogdanfinn/fhttp"
+)
+
+const (
+	RetryGroupChatGPT      = "chatgpt"
+	RetryGroupConversation = "conversation"
+	RetryGroupPlatform     = "platform"
+
+	retryDrainLimit = 64 * 1024
+)
+
+// RetryPolicy decides how many times a request is sent when the upstream fails with 429/5xx (or the connection fails),
+// the delay grows exponentially from BaseDelay up to MaxDelay with jitter, Retry-After is used instead if sent,
+// a request which is not idempotent is only retried on the responses which mean it is not processed (429 and 503),
+// unless RetryNonIdempotent is set (the conversation request is retried only before anything is relayed to the client)
+type RetryPolicy struct {
+	MaxAttempts        int
+	BaseDelay          time.Duration
+	MaxDelay           time.Duration
+	RetryNonIdempotent bool
+}
+
+var retryPolicies = map[string]RetryPolicy{
+	RetryGroupChatGPT: {
+		MaxAttempts: 3,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    10 * time.Second,
+	},
+	RetryGroupConversation: {
+		MaxAttempts:        2,
+		BaseDelay:          time.Second,
+		MaxDelay:           10 * time.Second,
+		RetryNonIdempotent: true,
+	},
+	RetryGroupPlatform: {
+		MaxAttempts: 3,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    10 * time.Second,
+	},
+}
+
+// the policy of each group can be overridden with "attempts,base delay,max delay", e.g. GO_CHATGPT_API_RETRY_CHATGPT=3,500ms,10s
+//
+//goland:noinspection SpellCheckingInspection
+func init() {
+	for group, policy := range retryPolicies {
+		key := "GO_CHATGPT_API_RETRY_" + strings.ToUpper(group)
+		value := os.Getenv(key)
+		if value == "" {
+			continue
+		}
+
+		parts := strings.Split(value, ",")
+		if attempts, err := strconv.Atoi(strings.TrimSpace(parts[0])); err == nil && attempts > 0 {
+			policy.MaxAttempts = attempts
+		} else {
+			logger.Error(key + " is invalid: " + value)
+			continue
+		}
+		if len(parts) > 1 {
+			if delay, err := time.ParseDuration(strings.TrimSpace(parts[1])); err == nil && delay > 0 {
+				policy.BaseDelay = delay
+			}
+		}
+		if len(parts) > 2 {
+			if delay, err := time.ParseDuration(strings.TrimSpace(parts[2])); err == nil && delay > 0 {
+				policy.MaxDelay = delay
+			}
+		}
+		retryPolicies[group] = policy
+	}
+}
+
+// DoWithRetry sends the request with do until it succeeds or the policy of the group gives up,
+// the last response (or error) is returned as is, so the caller handles it the same as without retry,
+// the request is bound to ctx (the one of the caller), so it is canceled when the caller is gone
+//
+//goland:noinspection GoUnhandledErrorResult
+func DoWithRetry(ctx context.Context, group string, req *http.Request, do func(req *http.Request) (*http.Response, error)) (*http.Response, error) {
+	req = req.WithContext(ctx)
+	policy := retryPolicies[group]
+	idempotent := req.Method == http.MethodGet || req.Method == http.MethodHead || req.Method == http.MethodOptions
+	// the body can not be sent again without GetBody
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && req.GetBody != nil {
+			req.Body, _ = req.GetBody()
+		}
+
+		resp, err := do(req)
+		if attempt >= policy.MaxAttempts || !replayable || ctx.Err() != nil {
+			return resp, err
+		}
+
+		var delay time.Duration
+		if err != nil {
+			// the pool and the open breaker are not retried, they are not available for much longer than the backoff
+			var circuitOpenError *CircuitOpenError
+			if errors.Is(err, ErrNoAvailableAccessToken) || errors.As(err, &circuitOpenError) || (!idempotent && !policy.RetryNonIdempotent) {
+				return resp, err
+			}
+
+			delay = backoffDelay(policy, attempt)
+		} else {
+			if !isRetryableStatus(resp.StatusCode, idempotent || policy.RetryNonIdempotent) {
+				return resp, err
+			}
+
+			var ok bool
+			delay, ok = retryAfterDelay(resp)
+			if !ok {
+				delay = backoffDelay(policy, attempt)
+			} else if delay > policy.MaxDelay {
+				// it is better to let the client know than to hold the request for so long
+				return resp, err
+			}
+
+			io.Copy(io.Discard, io.LimitReader(resp.Body, retryDrainLimit))
+			resp.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func isRetryableStatus(statusCode int, allStatuses bool) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return allStatuses
+	}
+
+	return false
+}
+
+// backoffDelay is half of the exponential delay plus a random part of the other half
+func backoffDelay(policy RetryPolicy, attempt int) time.Duration {
+	delay := policy.BaseDelay << (attempt - 1)
+	if delay <= 0 || delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// retryAfterDelay parses Retry-After, which is either the seconds or an HTTP date
+func retryAfterDelay(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		delay := time.Until(date)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,434 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/linweiyuan/go-chatgpt-api/util/logger"
+
+	http "github.com/bogdanfinn/fhttp"
+)
+
+const (
+	TokenPoolStrategyRoundRobin = "round_robin"
+	TokenPoolStrategyLeastBusy  = "least_busy"
+
+	tokenPoolRateLimitCooldown = time.Minute
+	tokenPoolAuthCooldown      = 10 * time.Minute
+	tokenPoolPeekLimit         = 64 * 1024
+	defaultTokenPoolPinTTL     = 24 * time.Hour
+
+	// a 403 with this in the body is about the Arkose token of the request, not the access token
+	ArkoseRequiredKeyword = "arkose"
+
+	NoAvailableAccessTokenErrorMessage = "No available access token in the pool."
+)
+
+var ErrNoAvailableAccessToken = errors.New(NoAvailableAccessTokenErrorMessage)
+
+// a token pool lets callers share the registered ChatGPT access tokens with one pool key,
+// a token is picked per request and failed over on 401/403/429, conversations stay with the token which owns them
+// until they are idle for the pin ttl (or the token is disabled),
+// pools are indexed by the hash of the pool key so that keys which are only stored hashed can have a pool too
+var (
+	tokenPools      = make(map[string]*TokenPool)
+	tokenPoolsMutex sync.RWMutex
+	tokenPoolPinTTL = defaultTokenPoolPinTTL
+)
+
+type TokenPool struct {
+	mutex         sync.Mutex
+	strategy      string
+	accounts      []*pooledAccount
+	next          int
+	conversations map[string]*pinnedConversation
+	lastSweepTime time.Time
+}
+
+type pinnedConversation struct {
+	account *pooledAccount
+	expires time.Time
+}
+
+type pooledAccount struct {
+	accessToken   string
+	inFlight      int
+	disabledUntil time.Time
+}
+
+type releaseOnCloseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+//goland:noinspection SpellCheckingInspection
+func init() {
+	if ttl, err := time.ParseDuration(os.Getenv("GO_CHATGPT_API_TOKEN_POOL_PIN_TTL")); err == nil && ttl > 0 {
+		tokenPoolPinTTL = ttl
+	}
+
+	key := os.Getenv("GO_CHATGPT_API_TOKEN_POOL_KEY")
+	if key == "" {
+		return
+	}
+
+	accessTokens := splitAccessTokens(os.Getenv("GO_CHATGPT_API_TOKEN_POOL"))
+	if path := os.Getenv("GO_CHATGPT_API_TOKEN_POOL_FILE"); path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			logger.Error("Failed to read token pool file: " + err.Error())
+			os.Exit(1)
+		}
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			accessTokens = append(accessTokens, splitAccessTokens(scanner.Text())...)
+		}
+		file.Close()
+	}
+
+	RegisterTokenPool(HashKey(key), accessTokens, os.Getenv("GO_CHATGPT_API_TOKEN_POOL_STRATEGY"))
+
+	logger.Info("Token pool: " + strconv.Itoa(len(accessTokens)) + " access tokens, " + getTokenPool(key).strategy)
+}
+
+// HashKey returns the index of the pool key, the "Bearer " prefix is ignored
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(GetAccessToken(key)))
+	return hex.EncodeToString(sum[:])
+}
+
+// RegisterTokenPool creates (or replaces) the pool of the key hash with the access tokens
+func RegisterTokenPool(keyHash string, accessTokens []string, strategy string) {
+	if strategy != TokenPoolStrategyLeastBusy {
+		strategy = TokenPoolStrategyRoundRobin
+	}
+
+	pool := &TokenPool{
+		strategy:      strategy,
+		conversations: make(map[string]*pinnedConversation),
+		lastSweepTime: time.Now(),
+	}
+	for _, accessToken := range accessTokens {
+		pool.accounts = append(pool.accounts, &pooledAccount{
+			accessToken: accessToken,
+		})
+	}
+
+	tokenPoolsMutex.Lock()
+	defer tokenPoolsMutex.Unlock()
+
+	tokenPools[keyHash] = pool
+}
+
+func UnregisterTokenPool(keyHash string) {
+	tokenPoolsMutex.Lock()
+	defer tokenPoolsMutex.Unlock()
+
+	delete(tokenPools, keyHash)
+}
+
+func splitAccessTokens(value string) []string {
+	var accessTokens []string
+	for _, accessToken := range strings.Split(value, ",") {
+		accessToken = strings.TrimSpace(accessToken)
+		if accessToken != "" && !strings.HasPrefix(accessToken, "#") {
+			accessTokens = append(accessTokens, accessToken)
+		}
+	}
+
+	return accessTokens
+}
+
+// RegisteredAccessTokens returns the distinct access tokens of all pools
+func RegisteredAccessTokens() []string {
+	tokenPoolsMutex.RLock()
+	defer tokenPoolsMutex.RUnlock()
+
+	seen := make(map[string]bool)
+	var accessTokens []string
+	for _, pool := range tokenPools {
+		for _, account := range pool.accounts {
+			if !seen[account.accessToken] {
+				seen[account.accessToken] = true
+				accessTokens = append(accessTokens, account.accessToken)
+			}
+		}
+	}
+
+	return accessTokens
+}
+
+func getTokenPool(accessToken string) *TokenPool {
+	tokenPoolsMutex.RLock()
+	defer tokenPoolsMutex.RUnlock()
+
+	if len(tokenPools) == 0 {
+		return nil
+	}
+
+	return tokenPools[HashKey(accessToken)]
+}
+
+// DoWithAccessToken sends the request with the access token of the caller,
+// if the caller uses a pool key, a token of the pool is used instead (and failed over if needed)
+func DoWithAccessToken(req *http.Request, accessToken string, conversationID string) (*http.Response, error) {
+	pool := getTokenPool(accessToken)
+	if pool == nil {
+		req.Header.Set(AuthorizationHeader, GetAccessToken(accessToken))
+		return Client.Do(req)
+	}
+
+	return pool.do(req, conversationID)
+}
+
+// ResolveAccessToken returns a fixed token of the pool for a pool key, which is used by the long-running jobs
+func ResolveAccessToken(accessToken string) (string, error) {
+	pool := getTokenPool(accessToken)
+	if pool == nil {
+		return accessToken, nil
+	}
+
+	account, err := pool.pick("", nil)
+	if err != nil {
+		return "", err
+	}
+
+	pool.release(account)
+	return account.accessToken, nil
+}
+
+// PeekAccessToken returns the token which the next request of the conversation is sent with, nothing is reserved,
+// the access token itself is returned if it is not a pool key
+func PeekAccessToken(accessToken string, conversationID string) (string, error) {
+	pool := getTokenPool(accessToken)
+	if pool == nil {
+		return accessToken, nil
+	}
+
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	account, _, _ := pool.selectAccount(conversationID, nil)
+	if account == nil {
+		return "", ErrNoAvailableAccessToken
+	}
+
+	return account.accessToken, nil
+}
+
+// PinConversation records the token which owns the conversation, the request is the one which the conversation is created with
+func PinConversation(accessToken string, conversationID string, req *http.Request) {
+	pool := getTokenPool(accessToken)
+	if pool == nil || conversationID == "" {
+		return
+	}
+
+	usedAccessToken := req.Header.Get(AuthorizationHeader)
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	if pin, ok := pool.conversations[conversationID]; ok && time.Now().Before(pin.expires) {
+		return
+	}
+
+	for _, account := range pool.accounts {
+		if GetAccessToken(account.accessToken) == usedAccessToken {
+			pool.conversations[conversationID] = &pinnedConversation{
+				account: account,
+				expires: time.Now().Add(tokenPoolPinTTL),
+			}
+			return
+		}
+	}
+}
+
+func (pool *TokenPool) do(req *http.Request, conversationID string) (*http.Response, error) {
+	tried := make(map[*pooledAccount]bool)
+	for {
+		account, err := pool.pick(conversationID, tried)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(tried) != 0 && req.GetBody != nil {
+			req.Body, _ = req.GetBody()
+		}
+		tried[account] = true
+
+		req.Header.Set(AuthorizationHeader, GetAccessToken(account.accessToken))
+		resp, err := Client.Do(req)
+		if err != nil {
+			pool.release(account)
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusForbidden && isArkoseRequired(resp) {
+			// the same account is used again with an Arkose token by the caller
+			resp.Body = &releaseOnCloseBody{
+				ReadCloser: resp.Body,
+				release: func() {
+					pool.release(account)
+				},
+			}
+			return resp, nil
+		}
+
+		if resp.StatusCode == http.StatusUnauthorized ||
+			resp.StatusCode == http.StatusForbidden ||
+			resp.StatusCode == http.StatusTooManyRequests {
+			// a pinned conversation is failed over too, the token which takes over owns it then
+			pool.disable(account, resp)
+			if pool.hasUntried(tried) && (req.Body == nil || req.GetBody != nil) {
+				resp.Body.Close()
+				pool.release(account)
+				continue
+			}
+		}
+
+		resp.Body = &releaseOnCloseBody{
+			ReadCloser: resp.Body,
+			release: func() {
+				pool.release(account)
+			},
+		}
+		return resp, nil
+	}
+}
+
+// pick returns the owner of the conversation if pinned, otherwise picks an available token by the strategy
+func (pool *TokenPool) pick(conversationID string, tried map[*pooledAccount]bool) (*pooledAccount, error) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	now := time.Now()
+	pool.sweep(now)
+	account, index, pinned := pool.selectAccount(conversationID, tried)
+	if account == nil {
+		return nil, ErrNoAvailableAccessToken
+	}
+
+	if pinned {
+		pool.conversations[conversationID].expires = now.Add(tokenPoolPinTTL)
+	} else {
+		// the pin is expired or its token is disabled (or tried), the token which takes over gets pinned instead
+		delete(pool.conversations, conversationID)
+		if pool.strategy == TokenPoolStrategyRoundRobin {
+			pool.next = index + 1
+		}
+	}
+	account.inFlight++
+	return account, nil
+}
+
+// selectAccount returns the account which the next request of the conversation goes to (and its index), the pool is not changed
+func (pool *TokenPool) selectAccount(conversationID string, tried map[*pooledAccount]bool) (*pooledAccount, int, bool) {
+	now := time.Now()
+	if pin, ok := pool.conversations[conversationID]; ok && conversationID != "" && now.Before(pin.expires) &&
+		!tried[pin.account] && !now.Before(pin.account.disabledUntil) {
+		return pin.account, -1, true
+	}
+
+	var picked *pooledAccount
+	pickedIndex := -1
+	for i := 0; i < len(pool.accounts); i++ {
+		index := (pool.next + i) % len(pool.accounts)
+		account := pool.accounts[index]
+		if tried[account] || now.Before(account.disabledUntil) {
+			continue
+		}
+
+		if pool.strategy == TokenPoolStrategyRoundRobin {
+			return account, index, false
+		}
+
+		if picked == nil || account.inFlight < picked.inFlight {
+			picked = account
+			pickedIndex = index
+		}
+	}
+
+	return picked, pickedIndex, false
+}
+
+// sweep removes the pins of the idle conversations, the pool must be locked
+func (pool *TokenPool) sweep(now time.Time) {
+	if now.Sub(pool.lastSweepTime) < tokenPoolPinTTL {
+		return
+	}
+
+	for conversationID, pin := range pool.conversations {
+		if !now.Before(pin.expires) {
+			delete(pool.conversations, conversationID)
+		}
+	}
+	pool.lastSweepTime = now
+}
+
+func (pool *TokenPool) hasUntried(tried map[*pooledAccount]bool) bool {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	now := time.Now()
+	for _, account := range pool.accounts {
+		if !tried[account] && !now.Before(account.disabledUntil) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (pool *TokenPool) release(account *pooledAccount) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	account.inFlight--
+}
+
+// disable takes the token out of rotation for a while, Retry-After is honored for 429
+func (pool *TokenPool) disable(account *pooledAccount, resp *http.Response) {
+	cooldown := tokenPoolAuthCooldown
+	if resp.StatusCode == http.StatusTooManyRequests {
+		cooldown = tokenPoolRateLimitCooldown
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			cooldown = time.Duration(seconds) * time.Second
+		}
+	}
+
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	account.disabledUntil = time.Now().Add(cooldown)
+	logger.Error("Access token is disabled for " + cooldown.String() + ", status code: " + strconv.Itoa(resp.StatusCode))
+}
+
+// isArkoseRequired peeks the body of the response, which is still readable from the start after this
+func isArkoseRequired(resp *http.Response) bool {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, tokenPoolPeekLimit))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{
+		Reader: io.MultiReader(bytes.NewReader(data), resp.Body),
+		Closer: resp.Body,
+	}
+
+	return strings.Contains(strings.ToLower(string(data)), ArkoseRequiredKeyword)
+}
+
+func (body *releaseOnCloseBody) Close() error {
+	body.once.Do(body.release)
+	return body.ReadCloser.Close()
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	http "github.com/bogdanfinn/fhttp"
+)
+
+const (
+	totpPeriod  = 30
+	totpDigits  = 6
+	totpModulus = 1000000
+
+	InvalidTOTPSecretErrorMessage = "TOTP secret is not a valid base32 string."
+)
+
+// GenerateTOTP returns the current code of the authenticator app (RFC 6238, SHA1, 30 seconds, 6 digits)
+func GenerateTOTP(secret string, now time.Time) (string, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(secret), " ", ""))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+	if err != nil || len(key) == 0 {
+		return "", errors.New(InvalidTOTPSecretErrorMessage)
+	}
+
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(now.Unix()/totpPeriod))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, code%totpModulus), nil
+}
+
+// OneTimePassword returns the OTP of the login, which is generated if only the TOTP secret is given
+func (loginInfo LoginInfo) OneTimePassword() (string, error) {
+	if otp := strings.TrimSpace(loginInfo.OTP); otp != "" {
+		return otp, nil
+	}
+
+	if loginInfo.TOTPSecret != "" {
+		return GenerateTOTP(loginInfo.TOTPSecret, time.Now())
+	}
+
+	return "", ErrOTPRequired
+}
+
+// CheckPasswordWithOTP checks the password, then completes the OTP challenge if two-factor authentication is enabled
+func CheckPasswordWithOTP(authLogin AuthLogin, state string, loginInfo LoginInfo) (string, int, error) {
+	code, statusCode, err := authLogin.CheckPassword(state, loginInfo.Username, loginInfo.Password)
+	if !errors.Is(err, ErrOTPRequired) {
+		return code, statusCode, err
+	}
+
+	if code != "" {
+		state = code
+	}
+
+	otp, err := loginInfo.OneTimePassword()
+	if err != nil {
+		return "", http.StatusBadRequest, err
+	}
+
+	return authLogin.CheckOTP(state, otp)
+}
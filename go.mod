@@ -11,6 +11,7 @@ require (
 	github.com/joho/godotenv v1.5.1
 	github.com/json-iterator/go v1.1.12
 	github.com/sirupsen/logrus v1.9.0
+	go.etcd.io/bbolt v1.3.8
 )
 
 require (
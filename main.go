@@ -3,11 +3,14 @@ package main
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/linweiyuan/go-chatgpt-api/api"
+	"github.com/linweiyuan/go-chatgpt-api/api/apikey"
+	"github.com/linweiyuan/go-chatgpt-api/api/archive"
 	"github.com/linweiyuan/go-chatgpt-api/api/chatgpt"
 	"github.com/linweiyuan/go-chatgpt-api/api/platform"
 	_ "github.com/linweiyuan/go-chatgpt-api/env"
 	"github.com/linweiyuan/go-chatgpt-api/middleware"
 	"log"
+	"net/http"
 	"os"
 	"strings"
 )
@@ -24,19 +27,25 @@ func main() {
 
 	router.Use(middleware.CORSMiddleware())
 	router.Use(middleware.CheckHeaderMiddleware())
+	router.Use(middleware.ProxyKeyMiddleware())
+	router.Use(middleware.RateLimitMiddleware())
+	router.Use(middleware.ManagedSessionMiddleware())
 
 	setupChatGPTAPIs(router)
 	setupPlatformAPIs(router)
-	setupPandoraAPIs(router)
+	setupImitateAPIs(router)
+	setupArchiveAPIs(router)
+	setupAdminAPIs(router)
 	router.NoRoute(api.Proxy)
 
 	router.GET("/healthCheck", api.HealthCheck)
+	router.GET("/token/introspect", api.IntrospectToken)
 
 	port := os.Getenv("GO_CHATGPT_API_PORT")
 	if port == "" {
 		port = "4141"
 	}
-	err := router.Run(":" + port)
+	err := http.ListenAndServe(":"+port, setupPandoraAPIs(router))
 	if err != nil {
 		log.Fatal("Failed to start server: " + err.Error())
 	}
@@ -47,6 +56,16 @@ func setupChatGPTAPIs(router *gin.Engine) {
 	chatgptGroup := router.Group("/chatgpt")
 	{
 		chatgptGroup.POST("/login", chatgpt.Login)
+		chatgptGroup.POST("/login/session", chatgpt.LoginWithSessionToken)
+		chatgptGroup.POST("/login/start", chatgpt.StartLogin)
+		chatgptGroup.POST("/login/continue", chatgpt.ContinueLogin)
+
+		sessionsGroup := chatgptGroup.Group("/sessions")
+		{
+			sessionsGroup.POST("", chatgpt.CreateManagedSession)
+			sessionsGroup.GET("", chatgpt.GetManagedSession)
+			sessionsGroup.DELETE("", chatgpt.DeleteManagedSession)
+		}
 
 		conversationsGroup := chatgptGroup.Group("/conversations")
 		{
@@ -55,6 +74,10 @@ func setupChatGPTAPIs(router *gin.Engine) {
 			// PATCH is official method, POST is added for Java support
 			conversationsGroup.PATCH("", chatgpt.ClearConversations)
 			conversationsGroup.POST("", chatgpt.ClearConversations)
+
+			conversationsGroup.POST("/export", chatgpt.CreateExportJob)
+			conversationsGroup.GET("/export/:id", chatgpt.GetExportJob)
+			conversationsGroup.GET("/export/:id/download", chatgpt.DownloadExportJob)
 		}
 
 		conversationGroup := chatgptGroup.Group("/conversation")
@@ -62,6 +85,10 @@ func setupChatGPTAPIs(router *gin.Engine) {
 			conversationGroup.POST("", chatgpt.CreateConversation)
 			conversationGroup.POST("/gen_title/:id", chatgpt.GenerateTitle)
 			conversationGroup.GET("/:id", chatgpt.GetConversation)
+			conversationGroup.GET("/:id/export", chatgpt.ExportConversation)
+			conversationGroup.GET("/:id/current_node", chatgpt.GetCurrentNode)
+			conversationGroup.GET("/:id/branches/:message_id", chatgpt.GetBranches)
+			conversationGroup.GET("/:id/path/:message_id", chatgpt.GetPath)
 
 			// rename or delete conversation use a same API with different parameters
 			conversationGroup.PATCH("/:id", chatgpt.UpdateConversation)
@@ -80,10 +107,12 @@ func setupPlatformAPIs(router *gin.Engine) {
 	platformGroup := router.Group("/platform")
 	{
 		platformGroup.POST("/login", platform.Login)
+		platformGroup.POST("/token/refresh", platform.RefreshToken)
 
 		apiGroup := platformGroup.Group("/v1")
 		{
 			apiGroup.POST("/chat/completions", platform.CreateChatCompletions)
+			apiGroup.POST("/messages", platform.CreateMessages)
 			apiGroup.POST("/completions", platform.CreateCompletions)
 			apiGroup.POST("/embeddings", platform.CreateEmbeddings)
 			apiGroup.GET("/files", platform.ListFiles)
@@ -111,17 +140,51 @@ func setupPlatformAPIs(router *gin.Engine) {
 	}
 }
 
+// OpenAI compatible APIs served by the ChatGPT web backend
+func setupImitateAPIs(router *gin.Engine) {
+	imitateGroup := router.Group("/imitate/v1")
+	{
+		imitateGroup.POST("/chat/completions", chatgpt.CreateChatCompletions)
+		imitateGroup.POST("/completions", chatgpt.CreateCompletions)
+		imitateGroup.POST("/messages", chatgpt.CreateMessages)
+	}
+}
+
+func setupArchiveAPIs(router *gin.Engine) {
+	conversationsGroup := router.Group("/archive/conversations")
+	{
+		conversationsGroup.GET("", archive.ListConversations)
+		conversationsGroup.GET("/search", archive.SearchConversations)
+		conversationsGroup.GET("/:id", archive.GetConversation)
+	}
+}
+
+func setupAdminAPIs(router *gin.Engine) {
+	adminGroup := router.Group("/admin", middleware.AdminMiddleware())
+	{
+		adminGroup.POST("/keys", apikey.CreateProxyKey)
+		adminGroup.GET("/keys", apikey.ListProxyKeys)
+		adminGroup.DELETE("/keys/:id", apikey.RevokeProxyKey)
+		adminGroup.GET("/accounts", chatgpt.GetAccountsHealth)
+		adminGroup.GET("/arkose", chatgpt.GetArkosePoolStats)
+		adminGroup.GET("/breakers", api.GetCircuitBreakers)
+	}
+}
+
+// the path is rewritten before routing, so that the middlewares (e.g. the rate limit) run only once for the Pandora APIs
+//
 //goland:noinspection SpellCheckingInspection
-func setupPandoraAPIs(router *gin.Engine) {
+func setupPandoraAPIs(router *gin.Engine) http.Handler {
 	pandoraEnabled := os.Getenv("GO_CHATGPT_API_PANDORA") != ""
-	if pandoraEnabled {
-		router.GET("/api/*path", func(c *gin.Context) {
-			c.Request.URL.Path = strings.ReplaceAll(c.Request.URL.Path, "/api", "/chatgpt/backend-api")
-			router.HandleContext(c)
-		})
-		router.POST("/api/*path", func(c *gin.Context) {
-			c.Request.URL.Path = strings.ReplaceAll(c.Request.URL.Path, "/api", "/chatgpt/backend-api")
-			router.HandleContext(c)
-		})
+	if !pandoraEnabled {
+		return router
 	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method == http.MethodGet || r.Method == http.MethodPost) && strings.HasPrefix(r.URL.Path, "/api/") {
+			r.URL.Path = "/chatgpt/backend-api" + strings.TrimPrefix(r.URL.Path, "/api")
+		}
+
+		router.ServeHTTP(w, r)
+	})
 }
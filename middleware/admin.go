@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/linweiyuan/go-chatgpt-api/api"
+)
+
+const (
+	adminDisabledErrorMessage = "Admin APIs are not enabled, set GO_CHATGPT_API_ADMIN_KEY to enable them."
+	invalidAdminKeyMessage    = "Invalid admin key."
+)
+
+var adminKey string
+
+//goland:noinspection SpellCheckingInspection
+func init() {
+	adminKey = os.Getenv("GO_CHATGPT_API_ADMIN_KEY")
+}
+
+// AdminMiddleware guards the admin APIs with the admin key, they are disabled if no admin key is set
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if adminKey == "" {
+			c.AbortWithStatusJSON(http.StatusNotFound, api.ReturnMessage(adminDisabledErrorMessage))
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(api.GetAccessToken(c.GetHeader(api.AuthorizationHeader))), []byte(api.GetAccessToken(adminKey))) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, api.ReturnMessage(invalidAdminKeyMessage))
+			return
+		}
+
+		c.Next()
+	}
+}
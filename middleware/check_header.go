@@ -2,17 +2,34 @@ package middleware
 
 import (
 	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/linweiyuan/go-chatgpt-api/api"
+	"github.com/linweiyuan/go-chatgpt-api/api/anthropic"
 )
 
+var rejectExpiredToken bool
+
+//goland:noinspection SpellCheckingInspection
+func init() {
+	rejectExpiredToken = os.Getenv("GO_CHATGPT_API_REJECT_EXPIRED_TOKEN") != ""
+}
+
 //goland:noinspection SpellCheckingInspection
 func CheckHeaderMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// Anthropic clients send the key with x-api-key
+		if c.GetHeader(api.AuthorizationHeader) == "" && c.GetHeader(anthropic.ApiKeyHeader) != "" {
+			c.Request.Header.Set(api.AuthorizationHeader, c.GetHeader(anthropic.ApiKeyHeader))
+		}
+
 		if c.GetHeader(api.AuthorizationHeader) == "" &&
-			c.Request.URL.Path != "/chatgpt/login" &&
+			!strings.HasPrefix(c.Request.URL.Path, "/chatgpt/login") &&
 			c.Request.URL.Path != "/platform/login" &&
+			!strings.HasPrefix(c.Request.URL.Path, "/chatgpt/sessions") &&
 			c.Request.URL.Path != "/healthCheck" &&
 			c.Request.URL.Path != "/chatgpt/public-api/conversation_limit" {
 			c.String(http.StatusOK, api.ReadyHint)
@@ -20,6 +37,15 @@ func CheckHeaderMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// decode the JWT locally, other tokens (e.g. API keys) are not checked
+		if rejectExpiredToken && c.Request.URL.Path != "/token/introspect" {
+			claims, err := api.ParseAccessToken(c.GetHeader(api.AuthorizationHeader))
+			if err == nil && claims.Expired {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, api.ReturnMessage(api.AccessTokenExpiredMessage+claims.ExpiresAt.Format(time.RFC3339)))
+				return
+			}
+		}
+
 		c.Header("Content-Type", "application/json")
 		c.Next()
 	}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/linweiyuan/go-chatgpt-api/api"
+	"github.com/linweiyuan/go-chatgpt-api/api/chatgpt"
+
+	http "github.com/bogdanfinn/fhttp"
+)
+
+// ManagedSessionMiddleware replaces the session handle in Authorization with the current access token of the session
+func ManagedSessionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sessionID := strings.TrimSpace(strings.TrimPrefix(c.GetHeader(api.AuthorizationHeader), "Bearer"))
+		if strings.HasPrefix(sessionID, chatgpt.ManagedSessionPrefix) {
+			accessToken, ok := chatgpt.GetManagedSessionAccessToken(sessionID)
+			if !ok {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, api.ReturnMessage(chatgpt.ManagedSessionNotFoundErrorMessage))
+				return
+			}
+
+			c.Set(chatgpt.ManagedSessionContextKey, sessionID)
+			c.Request.Header.Set(api.AuthorizationHeader, api.GetAccessToken(accessToken))
+		}
+
+		c.Next()
+	}
+}
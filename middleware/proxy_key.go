@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/linweiyuan/go-chatgpt-api/api"
+	"github.com/linweiyuan/go-chatgpt-api/api/apikey"
+)
+
+var requireProxyKey bool
+
+//goland:noinspection SpellCheckingInspection
+func init() {
+	requireProxyKey = os.Getenv("GO_CHATGPT_API_REQUIRE_PROXY_KEY") != ""
+}
+
+// ProxyKeyMiddleware substitutes the upstream credential of the proxy key,
+// platform APIs get one of the mapped API keys, the ChatGPT access tokens are already a token pool of the proxy key
+func ProxyKeyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimSpace(strings.TrimPrefix(c.GetHeader(api.AuthorizationHeader), "Bearer"))
+		if !apikey.Enabled() || !strings.HasPrefix(key, apikey.ProxyKeyPrefix) {
+			// no Authorization is not a proxy key either, only the exempted paths are served without one
+			if requireProxyKey && !isProxyKeyExempted(c.Request.URL.Path) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, api.ReturnMessage(apikey.ProxyKeyRequiredErrorMessage))
+				return
+			}
+
+			c.Next()
+			return
+		}
+
+		proxyKey, ok := apikey.Lookup(key)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, api.ReturnMessage(apikey.InvalidProxyKeyErrorMessage))
+			return
+		}
+
+		c.Set(apikey.ContextKey, proxyKey)
+		if strings.HasPrefix(c.Request.URL.Path, "/platform") {
+			apiKey, ok := apikey.NextPlatformApiKey(proxyKey)
+			if !ok {
+				c.AbortWithStatusJSON(http.StatusForbidden, api.ReturnMessage(apikey.NoPlatformApiKeyMessage))
+				return
+			}
+
+			c.Request.Header.Set(api.AuthorizationHeader, api.GetAccessToken(apiKey))
+		} else if len(proxyKey.ChatGPTAccessTokens) == 0 {
+			c.AbortWithStatusJSON(http.StatusForbidden, api.ReturnMessage(apikey.NoChatGPTAccessTokenMessage))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// the admin key and the login APIs are not proxy keys, the managed sessions are not exempted,
+// otherwise anyone could create one with the credentials and use it instead of a proxy key
+func isProxyKeyExempted(path string) bool {
+	return strings.HasPrefix(path, "/admin") ||
+		strings.HasPrefix(path, "/chatgpt/login") ||
+		path == "/platform/login" ||
+		path == "/healthCheck" ||
+		path == "/token/introspect" ||
+		path == "/chatgpt/public-api/conversation_limit"
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/linweiyuan/go-chatgpt-api/api"
+	"github.com/linweiyuan/go-chatgpt-api/api/apikey"
+	"github.com/linweiyuan/go-chatgpt-api/api/chatgpt"
+	"github.com/linweiyuan/go-chatgpt-api/api/limiter"
+
+	http "github.com/bogdanfinn/fhttp"
+)
+
+// the requests which send messages, they count for the concurrent streams and the daily quotas
+var messagePaths = map[string]bool{
+	"/chatgpt/conversation":             true,
+	"/chatgpt/backend-api/conversation": true,
+	"/imitate/v1/chat/completions":      true,
+	"/imitate/v1/completions":           true,
+	"/imitate/v1/messages":              true,
+	"/platform/v1/chat/completions":     true,
+	"/platform/v1/completions":          true,
+	"/platform/v1/messages":             true,
+}
+
+// RateLimitMiddleware limits each caller, which is the proxy key if used, otherwise the Authorization value,
+// a managed session is identified by its handle (it runs before ManagedSessionMiddleware), so the identity survives the renewed access tokens,
+// the conversation sessions and the archive use the same identity
+func RateLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authorization := c.GetHeader(api.AuthorizationHeader)
+		if authorization == "" || strings.HasPrefix(c.Request.URL.Path, "/admin") {
+			c.Next()
+			return
+		}
+
+		identity := "token:" + api.HashKey(authorization)
+		if strings.HasPrefix(strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer")), chatgpt.ManagedSessionPrefix) {
+			identity = "session:" + api.HashKey(authorization)
+		}
+		var keyLimits *limiter.Limits
+		if value, ok := c.Get(apikey.ContextKey); ok {
+			proxyKey := value.(*apikey.ProxyKey)
+			identity = "key:" + proxyKey.ID
+			keyLimits = proxyKey.Limits
+		}
+
+		isMessage := c.Request.Method == http.MethodPost && messagePaths[c.Request.URL.Path]
+		release, done := limiter.Acquire(c, identity, limiter.GetLimits(keyLimits), isMessage)
+		if done {
+			return
+		}
+
+		defer release()
+		c.Next()
+	}
+}